@@ -0,0 +1,38 @@
+#ifndef __SECRDS_EVENT_H
+#define __SECRDS_EVENT_H
+
+/* Every perf record starts with this header; the Go decoder rejects
+ * records whose magic, version, type or length do not match. */
+
+#define SECRDS_EVENT_MAGIC 0x53435244 /* "SCRD" */
+#define SECRDS_EVENT_VERSION 1
+
+enum secrds_event_type {
+    SECRDS_EVENT_ACCEPT = 1,
+    SECRDS_EVENT_AUTH = 2,
+    SECRDS_EVENT_EXEC = 3,
+    SECRDS_EVENT_CONNECT = 4,
+};
+
+struct event_header {
+    __u32 magic;
+    __u16 version;
+    __u16 type;
+    __u32 length;
+    __u32 reserved;
+};
+
+/* Record sizes are fixed by the Go decoders and must not depend on the
+ * target architecture; a layout change needs a new SECRDS_EVENT_VERSION. */
+#define SECRDS_ASSERT_SIZE(type, size) \
+    _Static_assert(sizeof(type) == (size), #type " layout changed")
+
+#define SECRDS_INIT_HEADER(ev, event_type)          \
+    do {                                            \
+        (ev)->hdr.magic = SECRDS_EVENT_MAGIC;       \
+        (ev)->hdr.version = SECRDS_EVENT_VERSION;   \
+        (ev)->hdr.type = (event_type);              \
+        (ev)->hdr.length = sizeof(*(ev));           \
+    } while (0)
+
+#endif
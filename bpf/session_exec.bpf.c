@@ -0,0 +1,312 @@
+#include <linux/bpf.h>
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_tracing.h>
+#include <linux/ptrace.h>
+#include <linux/sched.h>
+
+#include "secrds_event.h"
+
+#define FILENAME_LEN 128
+#define ARG_LEN 64
+#define MAX_ARGS 8
+
+#define TCP_SYN_SENT 2
+#define TCP_LISTEN 10
+#define AF_INET 2
+#define AF_INET6 10
+
+enum connect_event_kind {
+    CONNECT_KIND_CONNECT = 0,
+    CONNECT_KIND_LISTEN = 1,
+};
+
+enum exec_event_kind {
+    EXEC_KIND_EXEC = 0,
+    EXEC_KIND_EXIT = 1,
+};
+
+struct exec_event {
+    struct event_header hdr;
+    __u32 pid;
+    __u32 tgid;
+    __u32 uid;
+    __u32 session_root;
+    __u64 ts_ns;
+    __u64 cgroup_id;
+    char comm[16];
+    __u8 kind;
+    __u8 argc;
+    char filename[FILENAME_LEN];
+    char argv[MAX_ARGS][ARG_LEN];
+};
+SECRDS_ASSERT_SIZE(struct exec_event, 712);
+
+struct connect_event {
+    struct event_header hdr;
+    __u32 pid;
+    __u32 tgid;
+    __u32 uid;
+    __u32 session_root;
+    __u64 ts_ns;
+    __u64 cgroup_id;
+    char comm[16];
+    __u16 family;
+    __u16 dport;
+    __u16 sport;
+    __u8 daddr[16];
+    __u8 saddr[16];
+    __u8 kind;
+};
+SECRDS_ASSERT_SIZE(struct connect_event, 104);
+
+struct trace_event_raw_inet_sock_set_state {
+    unsigned short common_type;
+    unsigned char common_flags;
+    unsigned char common_preempt_count;
+    int common_pid;
+    const void *skaddr;
+    int oldstate;
+    int newstate;
+    __u16 sport;
+    __u16 dport;
+    __u16 family;
+    __u16 protocol;
+    __u8 saddr[4];
+    __u8 daddr[4];
+    __u8 saddr_v6[16];
+    __u8 daddr_v6[16];
+};
+
+struct trace_event_raw_sys_enter {
+    unsigned short common_type;
+    unsigned char common_flags;
+    unsigned char common_preempt_count;
+    int common_pid;
+    long id;
+    unsigned long args[6];
+};
+
+struct trace_event_raw_sched_process_fork {
+    unsigned short common_type;
+    unsigned char common_flags;
+    unsigned char common_preempt_count;
+    int common_pid;
+    char parent_comm[16];
+    int parent_pid;
+    char child_comm[16];
+    int child_pid;
+};
+
+struct trace_event_raw_sched_process_template {
+    unsigned short common_type;
+    unsigned char common_flags;
+    unsigned char common_preempt_count;
+    int common_pid;
+    char comm[16];
+    int pid;
+    int prio;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, sizeof(__u32));
+    __uint(max_entries, 0);
+} exec_events SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, sizeof(__u32));
+    __uint(max_entries, 0);
+} connect_events SEC(".maps");
+
+/* tgid -> session root tgid, seeded from userspace when a session opens */
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, sizeof(__u32));
+    __uint(max_entries, 65536);
+} session_procs SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(key_size, sizeof(__u64));
+    __uint(value_size, sizeof(struct exec_event));
+    __uint(max_entries, 4096);
+} pending_exec SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, sizeof(struct exec_event));
+    __uint(max_entries, 1);
+} scratch SEC(".maps");
+
+static __always_inline struct exec_event *new_event(__u32 session_root, __u8 kind)
+{
+    __u32 zero = 0;
+    struct exec_event *ev = bpf_map_lookup_elem(&scratch, &zero);
+    if (!ev) {
+        return NULL;
+    }
+
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    __builtin_memset(ev, 0, sizeof(*ev));
+    SECRDS_INIT_HEADER(ev, SECRDS_EVENT_EXEC);
+    ev->pid = (__u32)pid_tgid;
+    ev->tgid = (__u32)(pid_tgid >> 32);
+    ev->uid = (__u32)bpf_get_current_uid_gid();
+    ev->session_root = session_root;
+    ev->ts_ns = bpf_ktime_get_ns();
+    ev->cgroup_id = bpf_get_current_cgroup_id();
+    ev->kind = kind;
+    bpf_get_current_comm(&ev->comm, sizeof(ev->comm));
+
+    return ev;
+}
+
+SEC("tracepoint/sched/sched_process_fork")
+int trace_sched_process_fork(struct trace_event_raw_sched_process_fork *ctx)
+{
+    /* The tracepoint runs in the parent, and parent_pid is the ID of the
+     * forking thread; session_procs is keyed by process. */
+    __u32 parent = (__u32)(bpf_get_current_pid_tgid() >> 32);
+    __u32 child = ctx->child_pid;
+
+    __u32 *root = bpf_map_lookup_elem(&session_procs, &parent);
+    if (!root) {
+        return 0;
+    }
+
+    __u32 value = *root;
+    bpf_map_update_elem(&session_procs, &child, &value, BPF_ANY);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_execve")
+int trace_enter_execve(struct trace_event_raw_sys_enter *ctx)
+{
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    __u32 tgid = (__u32)(pid_tgid >> 32);
+
+    __u32 *root = bpf_map_lookup_elem(&session_procs, &tgid);
+    if (!root) {
+        return 0;
+    }
+
+    struct exec_event *ev = new_event(*root, EXEC_KIND_EXEC);
+    if (!ev) {
+        return 0;
+    }
+
+    bpf_probe_read_user_str(ev->filename, sizeof(ev->filename), (const char *)ctx->args[0]);
+
+    const char *const *argv = (const char *const *)ctx->args[1];
+#pragma unroll
+    for (int i = 0; i < MAX_ARGS; i++) {
+        const char *arg = NULL;
+        bpf_probe_read_user(&arg, sizeof(arg), &argv[i]);
+        if (!arg) {
+            break;
+        }
+        bpf_probe_read_user_str(ev->argv[i], ARG_LEN, arg);
+        ev->argc = i + 1;
+    }
+
+    bpf_map_update_elem(&pending_exec, &pid_tgid, ev, BPF_ANY);
+    return 0;
+}
+
+SEC("tracepoint/sched/sched_process_exec")
+int trace_sched_process_exec(void *ctx)
+{
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+
+    struct exec_event *ev = bpf_map_lookup_elem(&pending_exec, &pid_tgid);
+    if (!ev) {
+        return 0;
+    }
+
+    ev->ts_ns = bpf_ktime_get_ns();
+    bpf_get_current_comm(&ev->comm, sizeof(ev->comm));
+    bpf_perf_event_output(ctx, &exec_events, BPF_F_CURRENT_CPU, ev, sizeof(*ev));
+    bpf_map_delete_elem(&pending_exec, &pid_tgid);
+
+    return 0;
+}
+
+SEC("tracepoint/sched/sched_process_exit")
+int trace_sched_process_exit(struct trace_event_raw_sched_process_template *ctx)
+{
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    __u32 pid = (__u32)pid_tgid;
+    __u32 tgid = (__u32)(pid_tgid >> 32);
+
+    bpf_map_delete_elem(&pending_exec, &pid_tgid);
+
+    if (pid != tgid) {
+        /* child_pid does not tell threads from processes, so threads are
+         * added under their own ID too and must leave with it. */
+        bpf_map_delete_elem(&session_procs, &pid);
+        return 0;
+    }
+
+    __u32 *root = bpf_map_lookup_elem(&session_procs, &tgid);
+    if (!root) {
+        return 0;
+    }
+
+    struct exec_event *ev = new_event(*root, EXEC_KIND_EXIT);
+    if (ev) {
+        bpf_perf_event_output(ctx, &exec_events, BPF_F_CURRENT_CPU, ev, sizeof(*ev));
+    }
+
+    bpf_map_delete_elem(&session_procs, &tgid);
+    return 0;
+}
+
+SEC("tracepoint/sock/inet_sock_set_state")
+int trace_inet_sock_set_state(struct trace_event_raw_inet_sock_set_state *ctx)
+{
+    if (ctx->newstate != TCP_SYN_SENT && ctx->newstate != TCP_LISTEN) {
+        return 0;
+    }
+
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    __u32 tgid = (__u32)(pid_tgid >> 32);
+
+    __u32 *root = bpf_map_lookup_elem(&session_procs, &tgid);
+    if (!root) {
+        return 0;
+    }
+
+    struct connect_event ev = {};
+    SECRDS_INIT_HEADER(&ev, SECRDS_EVENT_CONNECT);
+    ev.pid = (__u32)pid_tgid;
+    ev.tgid = tgid;
+    ev.uid = (__u32)bpf_get_current_uid_gid();
+    ev.session_root = *root;
+    ev.ts_ns = bpf_ktime_get_ns();
+    ev.cgroup_id = bpf_get_current_cgroup_id();
+    bpf_get_current_comm(&ev.comm, sizeof(ev.comm));
+
+    ev.kind = ctx->newstate == TCP_LISTEN ? CONNECT_KIND_LISTEN : CONNECT_KIND_CONNECT;
+    ev.family = ctx->family;
+    ev.sport = ctx->sport;
+    ev.dport = ctx->dport;
+    if (ctx->family == AF_INET) {
+        __builtin_memcpy(ev.saddr, ctx->saddr, 4);
+        __builtin_memcpy(ev.daddr, ctx->daddr, 4);
+    } else if (ctx->family == AF_INET6) {
+        __builtin_memcpy(ev.saddr, ctx->saddr_v6, 16);
+        __builtin_memcpy(ev.daddr, ctx->daddr_v6, 16);
+    } else {
+        return 0;
+    }
+
+    bpf_perf_event_output(ctx, &connect_events, BPF_F_CURRENT_CPU, &ev, sizeof(ev));
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
@@ -7,8 +7,21 @@
 #include <linux/sched.h>
 #include <linux/in.h>
 
+#include "secrds_event.h"
+
 struct sock;
 
+/* Offsets of sk->__sk_common.skc_net and net->ns.inum. They match common
+ * x86_64 and arm64 builds only; userspace checks the result against
+ * /proc/<pid>/ns/net and ignores it after a mismatch. */
+#ifndef SK_NET_OFFSET
+#define SK_NET_OFFSET 48
+#endif
+
+#ifndef NET_NS_INUM_OFFSET
+#define NET_NS_INUM_OFFSET 136
+#endif
+
 struct inet_sock {
     __be16 inet_sport;
     __be16 inet_dport;
@@ -26,6 +39,7 @@ struct trace_event_raw_sys_exit {
 };
 
 struct accept_event {
+    struct event_header hdr;
     __u32 pid;
     __u32 tgid;
     int fd;                
@@ -36,7 +50,10 @@ struct accept_event {
     __be32 local_ip;       
     __be16 local_port;     
     __u8 has_sock_info;    
+    __u64 cgroup_id;
+    __u32 netns;
 };
+SECRDS_ASSERT_SIZE(struct accept_event, 88);
 
 struct {
     __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
@@ -80,6 +97,24 @@ static __always_inline void extract_sock_info(struct sock *sk, struct accept_eve
     ev->has_sock_info = 1;
 }
 
+static __always_inline __u32 sock_netns(struct sock *sk)
+{
+    void *net = NULL;
+    __u32 inum = 0;
+
+    if (!sk) {
+        return 0;
+    }
+
+    bpf_probe_read_kernel(&net, sizeof(net), (char *)sk + SK_NET_OFFSET);
+    if (!net) {
+        return 0;
+    }
+    bpf_probe_read_kernel(&inum, sizeof(inum), (char *)net + NET_NS_INUM_OFFSET);
+
+    return inum;
+}
+
 
 SEC("kretprobe/inet_csk_accept")
 int kretprobe_inet_csk_accept(struct pt_regs *ctx)
@@ -92,21 +127,44 @@ int kretprobe_inet_csk_accept(struct pt_regs *ctx)
     __u64 pid_tgid = bpf_get_current_pid_tgid();
     
     struct accept_event ev = {};
+    SECRDS_INIT_HEADER(&ev, SECRDS_EVENT_ACCEPT);
     ev.pid = (__u32)pid_tgid;
     ev.tgid = (__u32)(pid_tgid >> 32);
     ev.fd = -1;  
     ev.ts_ns = bpf_ktime_get_ns();
     bpf_get_current_comm(&ev.comm, sizeof(ev.comm));
+    ev.cgroup_id = bpf_get_current_cgroup_id();
     
     extract_sock_info(newsk, &ev);
+    ev.netns = sock_netns(newsk);
     
     bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &ev, sizeof(ev));
     
     return 0;
 }
 
+/* Fallback for kernels without kprobes: report the new fd and let
+ * userspace resolve the peer through /proc/<pid>/fd and sock_diag. */
 static __always_inline int handle_accept_exit(struct trace_event_raw_sys_exit *ctx)
 {
+    if (ctx->ret < 0) {
+        return 0;
+    }
+
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+
+    struct accept_event ev = {};
+    SECRDS_INIT_HEADER(&ev, SECRDS_EVENT_ACCEPT);
+    ev.pid = (__u32)pid_tgid;
+    ev.tgid = (__u32)(pid_tgid >> 32);
+    ev.fd = (int)ctx->ret;
+    ev.ts_ns = bpf_ktime_get_ns();
+    bpf_get_current_comm(&ev.comm, sizeof(ev.comm));
+    ev.cgroup_id = bpf_get_current_cgroup_id();
+    ev.has_sock_info = 0;
+
+    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &ev, sizeof(ev));
+
     return 0;
 }
 
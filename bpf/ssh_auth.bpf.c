@@ -4,14 +4,63 @@
 #include <linux/ptrace.h>
 #include <linux/sched.h>
 
+#include "secrds_event.h"
+
+#define PAM_SERVICE_LEN 32
+#define PAM_ITEM_LEN 32
+
+#ifndef PAMH_SERVICE_NAME_OFFSET
+#define PAMH_SERVICE_NAME_OFFSET 40
+#endif
+
+#ifndef PAMH_USER_OFFSET
+#define PAMH_USER_OFFSET 48
+#endif
+
+#ifndef PAMH_RHOST_OFFSET
+#define PAMH_RHOST_OFFSET 56
+#endif
+
+#ifndef PAMH_TTY_OFFSET
+#define PAMH_TTY_OFFSET 72
+#endif
+
+#define PAM_RHOST_LEN 64
+
+enum auth_event_kind {
+    AUTH_KIND_AUTHENTICATE = 0,
+    AUTH_KIND_ACCT_MGMT = 1,
+    AUTH_KIND_OPEN_SESSION = 2,
+    AUTH_KIND_CLOSE_SESSION = 3,
+};
+
 struct auth_event {
+    struct event_header hdr;
     __u32 pid;
     __u32 tgid;
     __s32 ret_code;
     __u64 ts_ns;
     char comm[16];
     __u8 is_failure;
+    __u64 cgroup_id;
+    char service[PAM_SERVICE_LEN];
+    __u32 uid;
+    char user[PAM_ITEM_LEN];
+    char tty[PAM_ITEM_LEN];
+    __u8 kind;
+    char rhost[PAM_RHOST_LEN];
 };
+SECRDS_ASSERT_SIZE(struct auth_event, 240);
+
+static __always_inline void read_pam_item(__u64 pamh, __u32 offset, char *dst, __u32 len)
+{
+    char *item = NULL;
+
+    bpf_probe_read_user(&item, sizeof(item), (char *)pamh + offset);
+    if (item) {
+        bpf_probe_read_user_str(dst, len, item);
+    }
+}
 
 struct {
     __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
@@ -27,52 +76,109 @@ struct {
     __uint(max_entries, 1024);
 } pid_socket_map SEC(".maps");
 
-SEC("uprobe")
-int uprobe_pam_authenticate(struct pt_regs *ctx)
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(key_size, sizeof(__u64));
+    __uint(value_size, sizeof(__u64));
+    __uint(max_entries, 4096);
+} active_pamh SEC(".maps");
+
+static __always_inline int pam_enter(struct pt_regs *ctx)
 {
     __u64 pid_tgid = bpf_get_current_pid_tgid();
-    __u32 pid = (__u32)pid_tgid;
-    __u32 tgid = (__u32)(pid_tgid >> 32);
-
-    char comm[16] = {};
-    bpf_get_current_comm(&comm, sizeof(comm));
+    __u64 pamh = (__u64)PT_REGS_PARM1(ctx);
 
-    if (comm[0] != 's' || comm[1] != 's' || comm[2] != 'h' || comm[3] != 'd') {
+    if (!pamh) {
         return 0;
     }
+
+    bpf_map_update_elem(&active_pamh, &pid_tgid, &pamh, BPF_ANY);
     return 0;
 }
 
-SEC("uretprobe")
-int uretprobe_pam_authenticate(struct pt_regs *ctx)
+static __always_inline int pam_exit(struct pt_regs *ctx, __u8 kind)
 {
     __u64 pid_tgid = bpf_get_current_pid_tgid();
     __u32 pid = (__u32)pid_tgid;
     __u32 tgid = (__u32)(pid_tgid >> 32);
 
-    char comm[16] = {};
-    bpf_get_current_comm(&comm, sizeof(comm));
-
-    if (comm[0] != 's' || comm[1] != 's' || comm[2] != 'h' || comm[3] != 'd') {
-        return 0;
-    }
-
     long ret = PT_REGS_RC(ctx);
 
     struct auth_event ev = {};
+    SECRDS_INIT_HEADER(&ev, SECRDS_EVENT_AUTH);
     ev.pid = pid;
     ev.tgid = tgid;
     ev.ret_code = (__s32)ret;
     ev.ts_ns = bpf_ktime_get_ns();
+    ev.kind = kind;
 
     ev.is_failure = (ret != 0) ? 1 : 0;
 
     __builtin_memset(&ev.comm, 0, sizeof(ev.comm));
     bpf_get_current_comm(&ev.comm, sizeof(ev.comm));
+    ev.cgroup_id = bpf_get_current_cgroup_id();
+    ev.uid = (__u32)bpf_get_current_uid_gid();
+
+    __u64 *pamh = bpf_map_lookup_elem(&active_pamh, &pid_tgid);
+    if (pamh) {
+        read_pam_item(*pamh, PAMH_SERVICE_NAME_OFFSET, ev.service, sizeof(ev.service));
+        read_pam_item(*pamh, PAMH_USER_OFFSET, ev.user, sizeof(ev.user));
+        read_pam_item(*pamh, PAMH_TTY_OFFSET, ev.tty, sizeof(ev.tty));
+        read_pam_item(*pamh, PAMH_RHOST_OFFSET, ev.rhost, sizeof(ev.rhost));
+        bpf_map_delete_elem(&active_pamh, &pid_tgid);
+    }
 
     bpf_perf_event_output(ctx, &auth_events, BPF_F_CURRENT_CPU, &ev, sizeof(ev));
 
     return 0;
 }
 
+SEC("uprobe")
+int uprobe_pam_authenticate(struct pt_regs *ctx)
+{
+    return pam_enter(ctx);
+}
+
+SEC("uretprobe")
+int uretprobe_pam_authenticate(struct pt_regs *ctx)
+{
+    return pam_exit(ctx, AUTH_KIND_AUTHENTICATE);
+}
+
+SEC("uprobe")
+int uprobe_pam_acct_mgmt(struct pt_regs *ctx)
+{
+    return pam_enter(ctx);
+}
+
+SEC("uretprobe")
+int uretprobe_pam_acct_mgmt(struct pt_regs *ctx)
+{
+    return pam_exit(ctx, AUTH_KIND_ACCT_MGMT);
+}
+
+SEC("uprobe")
+int uprobe_pam_open_session(struct pt_regs *ctx)
+{
+    return pam_enter(ctx);
+}
+
+SEC("uretprobe")
+int uretprobe_pam_open_session(struct pt_regs *ctx)
+{
+    return pam_exit(ctx, AUTH_KIND_OPEN_SESSION);
+}
+
+SEC("uprobe")
+int uprobe_pam_close_session(struct pt_regs *ctx)
+{
+    return pam_enter(ctx);
+}
+
+SEC("uretprobe")
+int uretprobe_pam_close_session(struct pt_regs *ctx)
+{
+    return pam_exit(ctx, AUTH_KIND_CLOSE_SESSION);
+}
+
 char _license[] SEC("license") = "GPL";
\ No newline at end of file
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"secrds/internal/doctor"
+	"secrds/internal/monitor"
+)
+
+// objectFiles are the BPF objects the daemon loads, before the
+// per-architecture name is resolved.
+type objectFiles struct {
+	accept string
+	auth   string
+	exec   string
+}
+
+func objectsIn(dir string) objectFiles {
+	return objectFiles{
+		accept: filepath.Join(dir, "secrds.bpf.o"),
+		auth:   filepath.Join(dir, "secrds_auth.bpf.o"),
+		exec:   filepath.Join(dir, "secrds_exec.bpf.o"),
+	}
+}
+
+func diagnose(objs objectFiles) doctor.Report {
+	return doctor.Run(doctor.Options{
+		AcceptObject: monitor.ObjectPath(objs.accept),
+		AuthObject:   monitor.ObjectPath(objs.auth),
+		ExecObject:   monitor.ObjectPath(objs.exec),
+	})
+}
+
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	objectDir := fs.String("objects", ".", "directory holding the compiled BPF objects")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	rep := diagnose(objectsIn(*objectDir))
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+		for _, c := range rep.Checks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+		}
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "FEATURE\tMECHANISM")
+		fmt.Fprintf(tw, "accept\t%s\n", rep.Plan.Accept)
+		fmt.Fprintf(tw, "auth\t%s\n", rep.Plan.Auth)
+		fmt.Fprintf(tw, "exec\t%s\n", rep.Plan.Exec)
+		fmt.Fprintf(tw, "connect\t%s\n", rep.Plan.Connect)
+		fmt.Fprintf(tw, "socket lookup\t%s\n", rep.Plan.SocketLookup)
+		fmt.Fprintf(tw, "containers\t%s\n", rep.Plan.Containers)
+		tw.Flush()
+	}
+
+	if !rep.Plan.Monitoring() {
+		return 1
+	}
+	return 0
+}
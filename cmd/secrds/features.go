@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+
+	"secrds/internal/doctor"
+	"secrds/internal/logger"
+	"secrds/internal/monitor"
+)
+
+// startFeatures loads and attaches each monitoring feature the plan allows.
+// A feature that fails is logged and left off instead of stopping the
+// daemon, and whatever it had loaded or attached is released through its
+// unload function. The names of the features that are not running are
+// returned.
+func startFeatures(mon *monitor.Monitor, lg *logger.Logger, plan doctor.Plan, objs objectFiles) []string {
+	var degraded []string
+	start := func(feature, mechanism string, unload func(), steps ...func() error) bool {
+		if mechanism == doctor.Disabled {
+			lg.LogError("%s monitoring disabled: not supported on this host (see secrds doctor)", feature)
+			degraded = append(degraded, feature)
+			return false
+		}
+		for _, step := range steps {
+			if err := step(); err != nil {
+				if unload != nil {
+					unload()
+				}
+				lg.LogError("%s monitoring disabled: %v", feature, err)
+				degraded = append(degraded, feature)
+				return false
+			}
+		}
+		lg.LogInfo("%s monitoring enabled (%s)", feature, mechanism)
+		return true
+	}
+
+	start("accept", plan.Accept, mon.UnloadBPF,
+		func() error { return mon.LoadBPF(objs.accept) },
+		mon.Attach,
+		mon.StartPerfReader,
+	)
+	start("auth", plan.Auth, mon.UnloadAuthBPF,
+		func() error { return mon.LoadAuthBPF(objs.auth) },
+		mon.AttachAuthUprobe,
+		mon.StartAuthPerfReader,
+	)
+	exec := start("exec", plan.Exec, mon.UnloadExecBPF,
+		func() error { return mon.LoadExecBPF(objs.exec) },
+		mon.AttachExec,
+		mon.StartExecPerfReader,
+	)
+	if exec || plan.Exec == doctor.Disabled {
+		start("connect", plan.Connect, nil, mon.StartConnectPerfReader)
+	} else {
+		lg.LogError("connect monitoring disabled: it shares the exec BPF object")
+		degraded = append(degraded, "connect")
+	}
+	return degraded
+}
+
+func degradedStatus(degraded []string) string {
+	if len(degraded) == 0 {
+		return "Monitoring"
+	}
+	return "Monitoring (disabled: " + strings.Join(degraded, ", ") + ")"
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"secrds/internal/config"
+	"secrds/internal/systemd"
+)
+
+func runInstall(args []string) int {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	unitPath := fs.String("unit", "/etc/systemd/system/secrds.service", "where to write the unit file")
+	binary := fs.String("binary", "", "path of the secrds binary (default: this executable)")
+	configPath := fs.String("config", config.DefaultPath, "configuration file passed to the daemon")
+	objectDir := fs.String("objects", "/usr/local/lib/secrds", "directory holding the compiled BPF objects")
+	watchdog := fs.String("watchdog", "30s", "WatchdogSec= value, 0 disables the watchdog")
+	force := fs.Bool("force", false, "replace an existing unit file")
+	printOnly := fs.Bool("print", false, "print the unit instead of writing it")
+	fs.Parse(args)
+
+	if *binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to locate secrds binary: %v\n", err)
+			return 1
+		}
+		*binary = exe
+	}
+	bin, err := filepath.Abs(*binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid binary path: %v\n", err)
+		return 1
+	}
+
+	opts := systemd.UnitOptions{
+		Binary:           bin,
+		Config:           *configPath,
+		ObjectDir:        *objectDir,
+		Watchdog:         *watchdog,
+		LogsDirectory:    "secrds",
+		RuntimeDirectory: "secrds",
+	}
+
+	if *printOnly {
+		unit, err := systemd.RenderUnit(opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Print(unit)
+		return 0
+	}
+
+	if err := systemd.WriteUnit(*unitPath, opts, *force); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Wrote %s\n", *unitPath)
+	fmt.Printf("Copy secrds.%[1]s.bpf.o, secrds_auth.%[1]s.bpf.o and secrds_exec.%[1]s.bpf.o to %[2]s, then run:\n",
+		runtime.GOARCH, *objectDir)
+	fmt.Println("  systemctl daemon-reload && systemctl enable --now secrds")
+	return 0
+}
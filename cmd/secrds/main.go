@@ -1,16 +1,47 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
-
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/config"
+	"secrds/internal/control"
+	"secrds/internal/doctor"
+	"secrds/internal/geoip"
+	"secrds/internal/health"
 	"secrds/internal/logger"
 	"secrds/internal/monitor"
+	"secrds/internal/privdrop"
+	"secrds/internal/rdns"
+	"secrds/internal/response"
+	"secrds/internal/risk"
+	"secrds/internal/systemd"
+	"secrds/internal/threatintel"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "install":
+			os.Exit(runInstall(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "stats":
+			os.Exit(runStats(os.Args[2:]))
+		}
+	}
+
+	configPath := flag.String("config", config.DefaultPath, "path to the JSON configuration file")
+	flag.Parse()
 
 	logDir := "/var/log/secrds"
 	if _, err := os.Stat("/var/log"); err != nil {
@@ -27,65 +58,239 @@ func main() {
 	defer lg.Close()
 
 
-	mon := monitor.NewMonitor(lg)
+	notifier, err := systemd.NewNotifier()
+	if err != nil {
+		lg.LogError("Failed to set up systemd notifications: %v", err)
+		notifier = &systemd.Notifier{}
+	}
+	defer notifier.Close()
+	notifier.Status("Loading configuration")
 
 
-	bpfObjFile := "secrds.bpf.o"
-	if len(os.Args) > 1 {
-		bpfObjFile = os.Args[1]
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		lg.LogError("Failed to load config: %v", err)
+		os.Exit(1)
 	}
 
-	if err := mon.LoadBPF(bpfObjFile); err != nil {
-		lg.LogError("Failed to load BPF: %v", err)
+
+	alerts := alert.NewDispatcher(lg)
+	defer alerts.Close()
+	if err := alerts.Configure(cfg.Sinks); err != nil {
+		lg.LogError("Failed to set up alert sinks: %v", err)
 		os.Exit(1)
 	}
 
 
-	authBpfObjFile := "secrds_auth.bpf.o"
-	if err := mon.LoadAuthBPF(authBpfObjFile); err != nil {
-		lg.LogError("Failed to load auth BPF: %v", err)
-		os.Exit(1)
+	geo := geoip.NewEnricher(lg)
+	defer geo.Close()
+	if err := geo.Configure(cfg.GeoIP); err != nil {
+		lg.LogError("GeoIP enrichment disabled: %v", err)
+		if len(cfg.GeoFences) > 0 {
+			lg.LogError("Geo-fencing is inactive until a GeoIP database loads")
+		}
 	}
 
 
-	if err := mon.Attach(); err != nil {
-		lg.LogError("Failed to attach tracepoints: %v", err)
-		os.Exit(1)
+	intel := threatintel.NewFeeds(lg)
+	defer intel.Close()
+	if err := intel.Configure(cfg.ThreatIntel); err != nil {
+		lg.LogError("Threat feeds disabled: %v", err)
 	}
 
 
-	if err := mon.AttachAuthUprobe(); err != nil {
-		lg.LogError("Failed to attach auth uprobes: %v", err)
-		os.Exit(1)
+	var hostnames *rdns.Cache
+	if rd := cfg.ReverseDNS; rd.Enabled {
+		servers := rd.Servers
+		if len(servers) == 0 {
+			servers = rdns.SystemServers()
+		}
+		hostnames = rdns.New(&rdns.Client{Servers: servers}, rdns.Options{
+			Workers:     rd.Workers,
+			Timeout:     rd.Timeout.Duration,
+			MinTTL:      rd.MinTTL.Duration,
+			MaxTTL:      rd.MaxTTL.Duration,
+			NegativeTTL: rd.NegativeTTL.Duration,
+		}, func(addr netip.Addr, res rdns.Result) {
+			if res.Name != "" {
+				lg.LogInfoFields(res.Fields(), "Reverse DNS for %s resolved", addr)
+			}
+		})
+		defer hostnames.Close()
+		lg.LogInfo("Reverse DNS enabled using %v", servers)
 	}
 
 
-	if err := mon.StartPerfReader(); err != nil {
-		lg.LogError("Failed to start perf reader: %v", err)
-		os.Exit(1)
+	responder := response.New(lg, alerts)
+	defer responder.Close()
+	if err := responder.Open(); err != nil {
+		lg.LogError("Banned connections cannot be reset: %v", err)
+	}
+	scores := risk.New(cfg.Risk)
+
+
+	mon := monitor.NewMonitor(lg, cfg, alerts)
+	mon.SetGeoIP(geo)
+	mon.SetThreatIntel(intel)
+	mon.SetReverseDNS(hostnames)
+	mon.SetResponder(responder)
+	mon.SetRisk(scores)
+
+
+	notifier.Status("Probing kernel features")
+	objs := objectsIn(".")
+	if flag.NArg() > 0 {
+		objs.accept = flag.Arg(0)
+	}
+	diag := diagnose(objs)
+	for _, c := range diag.Checks {
+		if c.Status == doctor.StatusMissing {
+			lg.LogError("Doctor: %s missing: %s", c.Name, c.Detail)
+		}
 	}
+	plan := diag.Plan
+	lg.LogInfo("Feature plan: accept=%s auth=%s exec=%s connect=%s socket_lookup=%s containers=%s",
+		plan.Accept, plan.Auth, plan.Exec, plan.Connect, plan.SocketLookup, plan.Containers)
 
 
-	if err := mon.StartAuthPerfReader(); err != nil {
-		lg.LogError("Failed to start auth perf reader: %v", err)
+	notifier.Status("Loading BPF programs")
+	degraded := startFeatures(mon, lg, plan, objs)
+	if slices.Contains(degraded, "accept") && slices.Contains(degraded, "auth") {
+		lg.LogError("Neither accept nor auth monitoring could be started, exiting")
+		mon.Close()
 		os.Exit(1)
 	}
 	defer mon.Close()
 
 
+	reload := &reloader{path: *configPath, current: cfg, lg: lg, mon: mon, alerts: alerts, geo: geo, intel: intel, risk: scores}
+
+
+	ctl := control.NewServer(cfg.ControlSocket, lg)
+	ctl.Handle("health", func(args []string) (interface{}, error) {
+		return mon.HealthReport(), nil
+	})
+	ctl.Handle("capabilities", func(args []string) (interface{}, error) {
+		return map[string]interface{}{"report": diag, "disabled": degraded}, nil
+	})
+	ctl.Handle("bans", func(args []string) (interface{}, error) {
+		return responder.Bans(), nil
+	})
+	ctl.Handle("unban", func(args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("usage: unban <ip>")
+		}
+		addr, err := netip.ParseAddr(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if !responder.Unban(addr) {
+			return nil, fmt.Errorf("%s is not banned", addr)
+		}
+		lg.LogInfo("Unbanned %s via control socket", addr)
+		return map[string]interface{}{"unbanned": addr}, nil
+	})
+	ctl.Handle("stats", func(args []string) (interface{}, error) {
+		if len(args) == 0 {
+			return scores.Top(statsLimit), nil
+		}
+		if len(args) != 1 {
+			return nil, fmt.Errorf("usage: stats [ip]")
+		}
+		addr, err := netip.ParseAddr(args[0])
+		if err != nil {
+			return nil, err
+		}
+		s, ok := scores.Lookup(addr)
+		if !ok {
+			return nil, fmt.Errorf("no risk score for %s", addr)
+		}
+		return []risk.Score{s}, nil
+	})
+	ctl.Handle("reload", func(args []string) (interface{}, error) {
+		changes, err := reload.Reload()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"changes": changes}, nil
+	})
+	if err := ctl.Start(); err != nil {
+		lg.LogError("Failed to start control socket: %v", err)
+	}
+	defer ctl.Close()
+
+
+	if cfg.Health.Listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", health.Handler(mon.HealthReport))
+		srv := &http.Server{Addr: cfg.Health.Listen, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				lg.LogError("Health endpoint failed: %v", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+
+	if priv := cfg.Privileges; priv.User != "" {
+		res, err := privdrop.Drop(privdrop.Options{
+			User:         priv.User,
+			Group:        priv.Group,
+			Capabilities: priv.Capabilities,
+			Landlock:     priv.Landlock,
+			ReadPaths:    append(append(append([]string{filepath.Dir(*configPath)}, privdrop.DefaultReadPaths...), dataDirs(cfg)...), priv.ReadPaths...),
+			WritePaths:   append([]string{logDir, filepath.Dir(cfg.ControlSocket)}, priv.WritePaths...),
+			Seccomp:      priv.Seccomp,
+		})
+		if err != nil {
+			lg.LogError("Failed to drop privileges: %v", err)
+			os.Exit(1)
+		}
+		lg.LogInfo("Dropped privileges to uid %d gid %d (capabilities %v, landlock ABI %d, seccomp %v)",
+			res.Uid, res.Gid, res.Capabilities, res.Landlock, res.Seccomp)
+	}
+
+
 	lg.StartMonitoring()
+	notifier.Ready(degradedStatus(degraded))
 
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
 
 	go mon.ProcessEvents()
 	go mon.ProcessAuthEvents()
-
-
-	<-sigChan
+	go mon.ProcessExecEvents()
+	go mon.ProcessConnectEvents()
+	go mon.ReportPipelineStats()
+	go mon.WatchHealth()
+	go mon.WatchRisk()
+
+	supervisorDone := make(chan struct{})
+	go superviseSystemd(notifier, mon, lg, supervisorDone)
+
+
+	for running := true; running; {
+		select {
+		case <-hupChan:
+			notifier.Reloading()
+			status := degradedStatus(degraded)
+			if _, err := reload.Reload(); err != nil {
+				status += "; reload rejected: " + err.Error()
+			}
+			notifier.Ready(status)
+		case <-sigChan:
+			running = false
+		}
+	}
 	lg.LogInfo("Shutting down...")
+	notifier.Stopping()
+	close(supervisorDone)
 
 
 	mon.Close()
@@ -93,3 +298,15 @@ func main() {
 	lg.LogInfo("Exited")
 }
 
+// dataDirs are the directories of data files secrds rereads while running.
+// Landlock grants the directories so files replaced by rename stay readable.
+func dataDirs(cfg *config.Config) []string {
+	var dirs []string
+	for _, path := range cfg.GeoIP.Databases {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	for _, feed := range cfg.ThreatIntel.Feeds {
+		dirs = append(dirs, filepath.Dir(feed.Path))
+	}
+	return dirs
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"secrds/internal/alert"
+	"secrds/internal/config"
+	"secrds/internal/geoip"
+	"secrds/internal/logger"
+	"secrds/internal/monitor"
+	"secrds/internal/risk"
+	"secrds/internal/threatintel"
+)
+
+// reloader re-reads the config file for SIGHUP and the control socket's
+// reload command. A config that fails to load or validate is rejected and
+// the running one stays active.
+type reloader struct {
+	mu      sync.Mutex
+	path    string
+	current *config.Config
+	lg      *logger.Logger
+	mon     *monitor.Monitor
+	alerts  *alert.Dispatcher
+	geo     *geoip.Enricher
+	intel   *threatintel.Feeds
+	risk    *risk.Engine
+}
+
+func (r *reloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		r.lg.LogError("Rejected config reload, keeping the running config: %v", err)
+		return nil, err
+	}
+
+	// Build everything the new config needs before changing anything, so a
+	// rejected reload leaves the running sinks, databases and feeds alone.
+	applyGeo, err := r.geo.Prepare(cfg.GeoIP)
+	if err != nil {
+		r.lg.LogError("Failed to reload GeoIP databases, keeping the previous ones: %v", err)
+	}
+	applyIntel, err := r.intel.Prepare(cfg.ThreatIntel)
+	if err != nil {
+		r.lg.LogError("Failed to reload threat feeds, keeping the previous ones: %v", err)
+	}
+	applySinks, err := r.alerts.Prepare(cfg.Sinks)
+	if err != nil {
+		r.lg.LogError("Rejected config reload, keeping the running config: %v", err)
+		return nil, fmt.Errorf("invalid sinks: %w", err)
+	}
+
+	applySinks()
+	if applyGeo != nil {
+		applyGeo()
+	}
+	if applyIntel != nil {
+		applyIntel()
+	}
+	r.risk.Configure(cfg.Risk)
+
+	changes := config.Diff(r.current, cfg)
+	r.mon.ApplyConfig(cfg)
+	r.current = cfg
+
+	if len(changes) == 0 {
+		r.lg.LogInfo("Reloaded config from %s: no changes", r.path)
+	}
+	for _, c := range changes {
+		r.lg.LogInfo("Reloaded config from %s: %s", r.path, c)
+	}
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"secrds/internal/config"
+	"secrds/internal/control"
+	"secrds/internal/risk"
+)
+
+// statsLimit is how many scores the daemon returns without an address.
+const statsLimit = 100
+
+var signalOrder = []string{
+	risk.SignalFailure,
+	risk.SignalNewUsername,
+	risk.SignalThreatFeed,
+	risk.SignalGeoNovelty,
+	risk.SignalPreAuthDisconnect,
+	risk.SignalConnection,
+}
+
+// runStats asks the running daemon for risk scores: the highest ones, or
+// the full breakdown of one address.
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath, "path to the JSON configuration file")
+	socket := fs.String("socket", "", "control socket (default from the config)")
+	limit := fs.Int("n", 20, "number of addresses to list")
+	asJSON := fs.Bool("json", false, "print the scores as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: secrds stats [flags] [ip]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := *socket
+	if path == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		path = cfg.ControlSocket
+	}
+
+	raw, err := control.Call(path, "stats", fs.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var scores []risk.Score
+	if err := json.Unmarshal(raw, &scores); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse stats: %v\n", err)
+		return 1
+	}
+	if len(scores) > *limit {
+		scores = scores[:*limit]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(scores); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if fs.NArg() == 1 && len(scores) == 1 {
+		printBreakdown(tw, scores[0])
+	} else {
+		fmt.Fprintln(tw, "ADDRESS\tSCORE\tBAND\tUSERNAMES\tLAST SEEN\tBREAKDOWN")
+		for _, s := range scores {
+			fmt.Fprintf(tw, "%s\t%.1f\t%s\t%d\t%s ago\t%s\n",
+				s.Addr, s.Score, orDash(s.Band), s.Usernames, since(s.LastSeen), s.Summary())
+		}
+	}
+	tw.Flush()
+	return 0
+}
+
+func printBreakdown(tw *tabwriter.Writer, s risk.Score) {
+	fmt.Fprintf(tw, "address\t%s\n", s.Addr)
+	fmt.Fprintf(tw, "score\t%.1f\n", s.Score)
+	fmt.Fprintf(tw, "band\t%s\n", orDash(s.Band))
+	fmt.Fprintf(tw, "usernames tried\t%d\n", s.Usernames)
+	fmt.Fprintf(tw, "first seen\t%s ago\n", since(s.FirstSeen))
+	fmt.Fprintf(tw, "last seen\t%s ago\n", since(s.LastSeen))
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "SIGNAL\tPOINTS\tEVENTS")
+	for _, signal := range signalOrder {
+		fmt.Fprintf(tw, "%s\t%.1f\t%d\n", signal, s.Breakdown[signal], s.Counts[signal])
+	}
+}
+
+func since(t time.Time) time.Duration {
+	return time.Since(t).Round(time.Second)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"secrds/internal/health"
+	"secrds/internal/logger"
+	"secrds/internal/monitor"
+	"secrds/internal/systemd"
+)
+
+const statusInterval = 30 * time.Second
+
+// superviseSystemd sends WATCHDOG=1 only while every perf reader keeps
+// polling, so a wedged reader gets the unit restarted, and refreshes
+// STATUS= with the event counters.
+func superviseSystemd(n *systemd.Notifier, mon *monitor.Monitor, lg *logger.Logger, done <-chan struct{}) {
+	if !n.Enabled() {
+		return
+	}
+
+	watchdog := systemd.WatchdogInterval()
+	tick := statusInterval
+	if watchdog > 0 && watchdog/2 < tick {
+		tick = watchdog / 2
+	}
+	maxAge := tick
+	if maxAge < 3*time.Second {
+		maxAge = 3 * time.Second
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	lastStatus := time.Now()
+	var wasStalled bool
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		stalled := mon.StalledReaders(maxAge)
+		if len(stalled) > 0 {
+			if !wasStalled {
+				lg.LogError("Perf readers stalled, withholding watchdog: %s", strings.Join(stalled, ", "))
+			}
+			wasStalled = true
+			n.Status("Degraded: reader stalled: " + strings.Join(stalled, ", "))
+			continue
+		}
+		wasStalled = false
+
+		if watchdog > 0 {
+			n.Watchdog()
+		}
+		if time.Since(lastStatus) >= statusInterval {
+			n.Status(statusLine(mon.HealthReport()))
+			lastStatus = time.Now()
+		}
+	}
+}
+
+func statusLine(rep health.Report) string {
+	names := make([]string, 0, len(rep.Readers))
+	for name := range rep.Readers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lost uint64
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		r := rep.Readers[name]
+		lost += r.Lost
+		parts = append(parts, fmt.Sprintf("%s=%d", name, r.Received))
+	}
+
+	line := fmt.Sprintf("Monitoring (%s): %s, lost=%d", rep.Status, strings.Join(parts, " "), lost)
+	if rep.Reason != "" {
+		line += ": " + rep.Reason
+	}
+	return line
+}
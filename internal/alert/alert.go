@@ -0,0 +1,69 @@
+package alert
+
+import (
+	"sync"
+	"time"
+
+	"secrds/internal/logger"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+type Alert struct {
+	Type     string
+	Severity string
+	Message  string
+	Fields   []logger.Field
+	Time     time.Time
+}
+
+type Sink interface {
+	Send(a Alert) error
+	Close() error
+}
+
+type Dispatcher struct {
+	mu     sync.RWMutex
+	logger *logger.Logger
+	sinks  []Sink
+}
+
+func NewDispatcher(logger *logger.Logger, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		logger: logger,
+		sinks:  sinks,
+	}
+}
+
+func (d *Dispatcher) Raise(a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	if a.Severity == "" {
+		a.Severity = SeverityWarning
+	}
+
+	d.logger.LogAlert(a.Type, a.Severity, a.Message, a.Fields...)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.sinks {
+		if err := s.Send(a); err != nil {
+			d.logger.LogError("Failed to deliver %s alert: %v", a.Type, err)
+		}
+	}
+}
+
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.sinks {
+		s.Close()
+	}
+	d.sinks = nil
+	return nil
+}
@@ -0,0 +1,239 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"secrds/internal/config"
+	"secrds/internal/logger"
+)
+
+var severityRank = map[string]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+var errSinkFull = errors.New("sink queue is full")
+
+// Configure replaces the configured sinks with the ones described by defs.
+// The current sinks stay in place when any definition fails to build.
+func (d *Dispatcher) Configure(defs []config.Sink) error {
+	apply, err := d.Prepare(defs)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare builds the sinks described by defs without installing them. The
+// returned function swaps them in and closes the current ones; a reload
+// calls it only once every other part of the new config has been built.
+func (d *Dispatcher) Prepare(defs []config.Sink) (func(), error) {
+	sinks, err := d.newSinks(defs)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		d.mu.Lock()
+		old := d.sinks
+		d.sinks = sinks
+		d.mu.Unlock()
+
+		// Webhook sinks drain their queue on Close; don't hold up the caller.
+		go func() {
+			for _, s := range old {
+				s.Close()
+			}
+		}()
+	}, nil
+}
+
+func (d *Dispatcher) newSinks(defs []config.Sink) ([]Sink, error) {
+	sinks := make([]Sink, 0, len(defs))
+	for _, def := range defs {
+		s, err := d.newSink(def)
+		if err != nil {
+			for _, built := range sinks {
+				built.Close()
+			}
+			return nil, fmt.Errorf("sink %q: %w", def.Name, err)
+		}
+		sinks = append(sinks, &filteredSink{Sink: s, def: def})
+	}
+	return sinks, nil
+}
+
+func (d *Dispatcher) newSink(def config.Sink) (Sink, error) {
+	switch def.Type {
+	case config.SinkFile:
+		f, err := os.OpenFile(def.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", def.Path, err)
+		}
+		return &fileSink{file: f}, nil
+	case config.SinkWebhook:
+		return newWebhookSink(def.Name, def.URL, def.Timeout.Duration, d.logger.LogError), nil
+	case config.SinkSyslog:
+		w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_WARNING, "secrds")
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return &syslogSink{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", def.Type)
+}
+
+type record struct {
+	Time     time.Time         `json:"time"`
+	Type     string            `json:"type"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+func (a Alert) record() record {
+	r := record{Time: a.Time, Type: a.Type, Severity: a.Severity, Message: a.Message}
+	if len(a.Fields) > 0 {
+		r.Fields = make(map[string]string, len(a.Fields))
+		for _, f := range a.Fields {
+			if f.Value != "" {
+				r.Fields[f.Key] = f.Value
+			}
+		}
+	}
+	return r
+}
+
+type filteredSink struct {
+	Sink
+	def config.Sink
+}
+
+func (s *filteredSink) Send(a Alert) error {
+	if s.def.MinSeverity != "" && severityRank[a.Severity] < severityRank[s.def.MinSeverity] {
+		return nil
+	}
+	if len(s.def.Alerts) > 0 {
+		wanted := false
+		for _, t := range s.def.Alerts {
+			if t == a.Type {
+				wanted = true
+				break
+			}
+		}
+		if !wanted {
+			return nil
+		}
+	}
+	return s.Sink.Send(a)
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (s *fileSink) Send(a Alert) error {
+	data, err := json.Marshal(a.record())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func (s *syslogSink) Send(a Alert) error {
+	msg := fmt.Sprintf("%s: %s%s", a.Type, a.Message, logger.FormatFields(a.Fields))
+	switch a.Severity {
+	case SeverityCritical:
+		return s.w.Crit(msg)
+	case SeverityInfo:
+		return s.w.Info(msg)
+	}
+	return s.w.Warning(msg)
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
+
+// webhookSink posts alerts from its own goroutine so a slow endpoint never
+// holds up the worker that raised the alert.
+type webhookSink struct {
+	name     string
+	url      string
+	client   *http.Client
+	queue    chan Alert
+	done     chan struct{}
+	logError func(format string, args ...interface{})
+}
+
+func newWebhookSink(name, url string, timeout time.Duration, logError func(string, ...interface{})) *webhookSink {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	s := &webhookSink{
+		name:     name,
+		url:      url,
+		client:   &http.Client{Timeout: timeout},
+		queue:    make(chan Alert, 256),
+		done:     make(chan struct{}),
+		logError: logError,
+	}
+	go s.run()
+	return s
+}
+
+func (s *webhookSink) Send(a Alert) error {
+	select {
+	case s.queue <- a:
+		return nil
+	default:
+		return errSinkFull
+	}
+}
+
+func (s *webhookSink) run() {
+	defer close(s.done)
+	for a := range s.queue {
+		data, err := json.Marshal(a.record())
+		if err != nil {
+			continue
+		}
+		resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			s.logError("Webhook sink %s failed to deliver %s alert: %v", s.name, a.Type, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			s.logError("Webhook sink %s rejected %s alert: %s", s.name, a.Type, resp.Status)
+		}
+	}
+}
+
+func (s *webhookSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
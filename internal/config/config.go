@@ -0,0 +1,874 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"secrds/internal/pipeline"
+	"secrds/internal/privdrop"
+)
+
+const DefaultPath = "/etc/secrds/config.json"
+
+type Config struct {
+	Namespaces    []Namespace      `json:"namespaces"`
+	Services      []Service        `json:"services"`
+	PAMServices   []string         `json:"pam_services"`
+	PrivEsc       PrivEsc          `json:"privesc"`
+	Outbound      []OutboundPolicy `json:"outbound"`
+	Forwarding    ForwardingPolicy `json:"forwarding"`
+	Pipeline      Pipeline         `json:"pipeline"`
+	Health        Health           `json:"health"`
+	ControlSocket string           `json:"control_socket"`
+	Privileges    Privileges       `json:"privileges"`
+	Sinks         []Sink           `json:"sinks,omitempty"`
+	GeoIP         GeoIP            `json:"geoip"`
+	GeoFences     []GeoFence       `json:"geofence,omitempty"`
+	ThreatIntel   ThreatIntel      `json:"threat_intel"`
+	ReverseDNS    ReverseDNS       `json:"reverse_dns"`
+	Risk          Risk             `json:"risk"`
+}
+
+// Risk scores each source address from weighted signals that halve every
+// HalfLife. When a score rises into a band, the band's action runs. A
+// connection to one of PreAuthServices with no PAM activity from its
+// address within PreAuthTimeout counts as a pre-auth disconnect.
+type Risk struct {
+	Enabled         bool        `json:"enabled"`
+	HalfLife        Duration    `json:"half_life"`
+	PreAuthTimeout  Duration    `json:"preauth_timeout"`
+	PreAuthServices []string    `json:"preauth_services,omitempty"`
+	MaxTracked      int         `json:"max_tracked"`
+	Weights         RiskWeights `json:"weights"`
+	Bands           []RiskBand  `json:"bands,omitempty"`
+}
+
+// RiskWeights is the score each signal adds. ThreatFeed is scaled by the
+// highest feed score divided by 100 and counts once per address.
+type RiskWeights struct {
+	Failure           float64 `json:"failure"`
+	NewUsername       float64 `json:"new_username"`
+	ThreatFeed        float64 `json:"threat_feed"`
+	GeoNovelty        float64 `json:"geo_novelty"`
+	PreAuthDisconnect float64 `json:"preauth_disconnect"`
+	Connection        float64 `json:"connection"`
+}
+
+// RiskBand is entered when a score reaches Score. Entering it raises a
+// risk_band alert with Severity and, with the ban action, bans the address.
+type RiskBand struct {
+	Name        string   `json:"name"`
+	Score       float64  `json:"score"`
+	Severity    string   `json:"severity"`
+	Action      string   `json:"action"`
+	BanDuration Duration `json:"ban_duration,omitempty"`
+}
+
+// ReverseDNS adds forward-confirmed PTR names to accept and auth events.
+// Servers default to the nameservers in /etc/resolv.conf; a server without
+// a port uses 53.
+type ReverseDNS struct {
+	Enabled     bool     `json:"enabled"`
+	Servers     []string `json:"servers,omitempty"`
+	Workers     int      `json:"workers"`
+	Timeout     Duration `json:"timeout"`
+	MinTTL      Duration `json:"min_ttl"`
+	MaxTTL      Duration `json:"max_ttl"`
+	NegativeTTL Duration `json:"negative_ttl"`
+}
+
+// ThreatIntel lists local IP reputation feeds. Each file is checked for
+// changes every CheckInterval.
+type ThreatIntel struct {
+	Feeds         []Feed   `json:"feeds,omitempty"`
+	CheckInterval Duration `json:"check_interval"`
+}
+
+// Feed is one reputation list. Netset and CIDR files hold one address or
+// prefix per line and give every entry Score; CSV files carry a score per
+// row in ScoreColumn (columns count from 1). With Ban set, addresses
+// scoring at least BanScore are banned as soon as they connect.
+type Feed struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Format      string   `json:"format"`
+	Score       float64  `json:"score,omitempty"`
+	IPColumn    int      `json:"ip_column,omitempty"`
+	ScoreColumn int      `json:"score_column,omitempty"`
+	Ban         bool     `json:"ban,omitempty"`
+	BanScore    float64  `json:"ban_score,omitempty"`
+	BanDuration Duration `json:"ban_duration,omitempty"`
+}
+
+const (
+	FeedNetset = "netset"
+	FeedCIDR   = "cidr"
+	FeedCSV    = "csv"
+)
+
+// GeoFence restricts where connections to services and PAM logins may come
+// from, by GeoIP country and ASN. Services and PAMServices select what it
+// covers; an empty list covers every configured service or monitored PAM
+// service. Non-public addresses and AllowFrom are always exempt.
+type GeoFence struct {
+	Name           string   `json:"name"`
+	Services       []string `json:"services,omitempty"`
+	PAMServices    []string `json:"pam_services,omitempty"`
+	AllowCountries []string `json:"allow_countries,omitempty"`
+	DenyCountries  []string `json:"deny_countries,omitempty"`
+	AllowASNs      []uint32 `json:"allow_asns,omitempty"`
+	DenyASNs       []uint32 `json:"deny_asns,omitempty"`
+	AllowFrom      []string `json:"allow_from,omitempty"`
+	AllowUnknown   bool     `json:"allow_unknown,omitempty"`
+	Action         string   `json:"action"`
+	BanDuration    Duration `json:"ban_duration,omitempty"`
+
+	allowFrom []netip.Prefix
+}
+
+const (
+	ActionAlert = "alert"
+	ActionBan   = "ban"
+)
+
+// GeoIP lists local MMDB files (MaxMind or DB-IP country, city and ASN
+// databases) used to enrich event addresses. Each file is checked for
+// changes every CheckInterval.
+type GeoIP struct {
+	Databases     []string `json:"databases,omitempty"`
+	CheckInterval Duration `json:"check_interval"`
+}
+
+// Sink is an alert destination in addition to the log file.
+type Sink struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Path        string   `json:"path,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Timeout     Duration `json:"timeout,omitempty"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Alerts      []string `json:"alerts,omitempty"`
+}
+
+const (
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+	SinkSyslog  = "syslog"
+)
+
+// Privileges controls the drop to an unprivileged user once every probe is
+// attached. An empty User keeps secrds running as root.
+type Privileges struct {
+	User         string   `json:"user,omitempty"`
+	Group        string   `json:"group,omitempty"`
+	Capabilities []string `json:"capabilities"`
+	Landlock     bool     `json:"landlock"`
+	ReadPaths    []string `json:"read_paths,omitempty"`
+	WritePaths   []string `json:"write_paths,omitempty"`
+	Seccomp      bool     `json:"seccomp"`
+}
+
+type Health struct {
+	Listen        string   `json:"listen,omitempty"`
+	LossThreshold uint64   `json:"loss_threshold"`
+	CheckInterval Duration `json:"check_interval"`
+}
+
+type Pipeline struct {
+	QueueSize     int      `json:"queue_size"`
+	Workers       int      `json:"workers"`
+	Overflow      string   `json:"overflow"`
+	StatsInterval Duration `json:"stats_interval"`
+}
+
+func (p Pipeline) OverflowPolicy() pipeline.OverflowPolicy {
+	policy, err := pipeline.ParseOverflowPolicy(p.Overflow)
+	if err != nil {
+		return pipeline.OverflowDropOldest
+	}
+	return policy
+}
+
+type ForwardingPolicy struct {
+	AllowUsers []string `json:"allow_users,omitempty"`
+	DenyUsers  []string `json:"deny_users,omitempty"`
+	AllowFrom  []string `json:"allow_from,omitempty"`
+	DenyFrom   []string `json:"deny_from,omitempty"`
+
+	allowFrom []netip.Prefix
+	denyFrom  []netip.Prefix
+}
+
+type OutboundPolicy struct {
+	Name             string   `json:"name"`
+	SessionFrom      []string `json:"session_from,omitempty"`
+	SessionNotFrom   []string `json:"session_not_from,omitempty"`
+	DestinationPorts []int    `json:"destination_ports,omitempty"`
+	DestinationCIDRs []string `json:"destination_cidrs,omitempty"`
+
+	sessionFrom    []netip.Prefix
+	sessionNotFrom []netip.Prefix
+	destinations   []netip.Prefix
+}
+
+type PrivEsc struct {
+	Services    []string `json:"services"`
+	MaxFailures int      `json:"max_failures"`
+	Window      Duration `json:"window"`
+}
+
+type Namespace struct {
+	Name   string `json:"name"`
+	Inode  uint64 `json:"inode,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Ignore bool   `json:"ignore,omitempty"`
+}
+
+type Service struct {
+	Name       string        `json:"name"`
+	Ports      []int         `json:"ports,omitempty"`
+	Processes  []string      `json:"processes,omitempty"`
+	Namespaces []string      `json:"namespaces,omitempty"`
+	Policy     ServicePolicy `json:"policy"`
+}
+
+type ServicePolicy struct {
+	MaxConnections int      `json:"max_connections,omitempty"`
+	Window         Duration `json:"window,omitempty"`
+	Ignore         bool     `json:"ignore,omitempty"`
+}
+
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		Services: []Service{
+			{
+				Name:      "ssh",
+				Ports:     []int{22},
+				Processes: []string{"sshd"},
+				Policy: ServicePolicy{
+					MaxConnections: 20,
+					Window:         Duration{time.Minute},
+				},
+			},
+		},
+		PAMServices: []string{"sshd"},
+		PrivEsc: PrivEsc{
+			Services:    []string{"sudo", "su"},
+			MaxFailures: 3,
+			Window:      Duration{5 * time.Minute},
+		},
+		Pipeline: Pipeline{
+			QueueSize:     4096,
+			Workers:       4,
+			Overflow:      string(pipeline.OverflowDropOldest),
+			StatsInterval: Duration{time.Minute},
+		},
+		Health: Health{
+			LossThreshold: 100,
+			CheckInterval: Duration{30 * time.Second},
+		},
+		ControlSocket: "/run/secrds/control.sock",
+		GeoIP: GeoIP{
+			CheckInterval: Duration{time.Minute},
+		},
+		ThreatIntel: ThreatIntel{
+			CheckInterval: Duration{time.Minute},
+		},
+		ReverseDNS: ReverseDNS{
+			Workers:     4,
+			Timeout:     Duration{2 * time.Second},
+			MinTTL:      Duration{time.Minute},
+			MaxTTL:      Duration{time.Hour},
+			NegativeTTL: Duration{5 * time.Minute},
+		},
+		Risk: Risk{
+			Enabled:         true,
+			HalfLife:        Duration{10 * time.Minute},
+			PreAuthTimeout:  Duration{2 * time.Minute},
+			PreAuthServices: []string{"ssh"},
+			MaxTracked:      65536,
+			Weights: RiskWeights{
+				Failure:           10,
+				NewUsername:       5,
+				ThreatFeed:        30,
+				GeoNovelty:        15,
+				PreAuthDisconnect: 3,
+				Connection:        1,
+			},
+			Bands: []RiskBand{
+				{Name: "elevated", Score: 50, Severity: "warning", Action: ActionAlert},
+				{Name: "high", Score: 100, Severity: "critical", Action: ActionAlert},
+			},
+		},
+		Privileges: Privileges{
+			// CAP_SYS_ADMIN is left out on purpose: without setns, sock_diag
+			// lookups in container network namespaces fall back to /proc and
+			// bans cannot reset connections there. The host namespace socket
+			// is opened before the drop and keeps working. CAP_KILL lets
+			// bans end logins served by root-owned sshd processes.
+			Capabilities: []string{"CAP_SYS_PTRACE", "CAP_DAC_READ_SEARCH", "CAP_KILL"},
+			Seccomp:      true,
+		},
+	}
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Default(), nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := Default()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	names := make(map[string]bool)
+	for i := range c.Namespaces {
+		ns := &c.Namespaces[i]
+		if ns.Name == "" {
+			return fmt.Errorf("namespaces[%d]: name is required", i)
+		}
+		if names[ns.Name] {
+			return fmt.Errorf("namespaces[%d]: duplicate name %q", i, ns.Name)
+		}
+		names[ns.Name] = true
+
+		if ns.Inode == 0 && ns.Path == "" {
+			return fmt.Errorf("namespace %q: inode or path is required", ns.Name)
+		}
+		if ns.Inode == 0 {
+			inode, err := NetnsInode(ns.Path)
+			if err != nil {
+				return fmt.Errorf("namespace %q: %w", ns.Name, err)
+			}
+			ns.Inode = inode
+		}
+	}
+
+	services := make(map[string]bool)
+	for i, svc := range c.Services {
+		if svc.Name == "" {
+			return fmt.Errorf("services[%d]: name is required", i)
+		}
+		if services[svc.Name] {
+			return fmt.Errorf("services[%d]: duplicate name %q", i, svc.Name)
+		}
+		services[svc.Name] = true
+
+		if len(svc.Ports) == 0 && len(svc.Processes) == 0 {
+			return fmt.Errorf("service %q: at least one port or process is required", svc.Name)
+		}
+		for _, port := range svc.Ports {
+			if port <= 0 || port > 65535 {
+				return fmt.Errorf("service %q: invalid port %d", svc.Name, port)
+			}
+		}
+		for _, name := range svc.Namespaces {
+			if !names[name] {
+				return fmt.Errorf("service %q: unknown namespace %q", svc.Name, name)
+			}
+		}
+		if svc.Policy.MaxConnections < 0 || svc.Policy.Window.Duration < 0 {
+			return fmt.Errorf("service %q: policy values must not be negative", svc.Name)
+		}
+		if svc.Policy.MaxConnections > 0 && svc.Policy.Window.Duration == 0 {
+			return fmt.Errorf("service %q: max_connections requires a window", svc.Name)
+		}
+	}
+
+	if c.PrivEsc.MaxFailures < 0 || c.PrivEsc.Window.Duration < 0 {
+		return fmt.Errorf("privesc: values must not be negative")
+	}
+	if c.PrivEsc.MaxFailures > 0 && c.PrivEsc.Window.Duration == 0 {
+		return fmt.Errorf("privesc: max_failures requires a window")
+	}
+
+	for i := range c.Outbound {
+		p := &c.Outbound[i]
+		if p.Name == "" {
+			return fmt.Errorf("outbound[%d]: name is required", i)
+		}
+		var err error
+		if p.sessionFrom, err = ParsePrefixes(p.SessionFrom); err != nil {
+			return fmt.Errorf("outbound policy %q: session_from: %w", p.Name, err)
+		}
+		if p.sessionNotFrom, err = ParsePrefixes(p.SessionNotFrom); err != nil {
+			return fmt.Errorf("outbound policy %q: session_not_from: %w", p.Name, err)
+		}
+		if p.destinations, err = ParsePrefixes(p.DestinationCIDRs); err != nil {
+			return fmt.Errorf("outbound policy %q: destination_cidrs: %w", p.Name, err)
+		}
+		for _, port := range p.DestinationPorts {
+			if port <= 0 || port > 65535 {
+				return fmt.Errorf("outbound policy %q: invalid port %d", p.Name, port)
+			}
+		}
+	}
+
+	if c.Pipeline.QueueSize < 1 || c.Pipeline.Workers < 1 {
+		return fmt.Errorf("pipeline: queue_size and workers must be positive")
+	}
+	if _, err := pipeline.ParseOverflowPolicy(c.Pipeline.Overflow); err != nil {
+		return fmt.Errorf("pipeline: %w", err)
+	}
+
+	sinks := make(map[string]bool)
+	for i, s := range c.Sinks {
+		if s.Name == "" {
+			return fmt.Errorf("sinks[%d]: name is required", i)
+		}
+		if sinks[s.Name] {
+			return fmt.Errorf("sinks[%d]: duplicate name %q", i, s.Name)
+		}
+		sinks[s.Name] = true
+
+		switch s.Type {
+		case SinkFile:
+			if s.Path == "" {
+				return fmt.Errorf("sink %q: path is required", s.Name)
+			}
+		case SinkWebhook:
+			u, err := url.Parse(s.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("sink %q: url must be an http or https URL", s.Name)
+			}
+		case SinkSyslog:
+		default:
+			return fmt.Errorf("sink %q: unknown type %q", s.Name, s.Type)
+		}
+		switch s.MinSeverity {
+		case "", "info", "warning", "critical":
+		default:
+			return fmt.Errorf("sink %q: unknown min_severity %q", s.Name, s.MinSeverity)
+		}
+		if s.Timeout.Duration < 0 {
+			return fmt.Errorf("sink %q: timeout must not be negative", s.Name)
+		}
+	}
+
+	for i, path := range c.GeoIP.Databases {
+		if path == "" {
+			return fmt.Errorf("geoip: databases[%d]: path is required", i)
+		}
+	}
+	if c.GeoIP.CheckInterval.Duration < 0 {
+		return fmt.Errorf("geoip: check_interval must not be negative")
+	}
+
+	if len(c.GeoFences) > 0 && len(c.GeoIP.Databases) == 0 {
+		return fmt.Errorf("geofence: requires geoip.databases")
+	}
+	fences := make(map[string]bool)
+	for i := range c.GeoFences {
+		g := &c.GeoFences[i]
+		if g.Name == "" {
+			return fmt.Errorf("geofence[%d]: name is required", i)
+		}
+		if fences[g.Name] {
+			return fmt.Errorf("geofence[%d]: duplicate name %q", i, g.Name)
+		}
+		fences[g.Name] = true
+
+		if len(g.AllowCountries)+len(g.DenyCountries)+len(g.AllowASNs)+len(g.DenyASNs) == 0 {
+			return fmt.Errorf("geofence %q: at least one country or ASN list is required", g.Name)
+		}
+		for _, cc := range append(append([]string(nil), g.AllowCountries...), g.DenyCountries...) {
+			if len(cc) != 2 {
+				return fmt.Errorf("geofence %q: %q is not an ISO 3166 country code", g.Name, cc)
+			}
+		}
+		for _, name := range g.Services {
+			if !services[name] {
+				return fmt.Errorf("geofence %q: unknown service %q", g.Name, name)
+			}
+		}
+		switch g.Action {
+		case ActionAlert, ActionBan:
+		default:
+			return fmt.Errorf("geofence %q: action must be %q or %q", g.Name, ActionAlert, ActionBan)
+		}
+		if g.BanDuration.Duration < 0 {
+			return fmt.Errorf("geofence %q: ban_duration must not be negative", g.Name)
+		}
+		var err error
+		if g.allowFrom, err = ParsePrefixes(g.AllowFrom); err != nil {
+			return fmt.Errorf("geofence %q: allow_from: %w", g.Name, err)
+		}
+	}
+
+	feeds := make(map[string]bool)
+	for i := range c.ThreatIntel.Feeds {
+		f := &c.ThreatIntel.Feeds[i]
+		if f.Name == "" {
+			return fmt.Errorf("threat_intel: feeds[%d]: name is required", i)
+		}
+		if feeds[f.Name] {
+			return fmt.Errorf("threat_intel: feeds[%d]: duplicate name %q", i, f.Name)
+		}
+		feeds[f.Name] = true
+
+		if f.Path == "" {
+			return fmt.Errorf("feed %q: path is required", f.Name)
+		}
+		switch f.Format {
+		case FeedNetset, FeedCIDR:
+		case FeedCSV:
+			if f.IPColumn == 0 {
+				f.IPColumn = 1
+			}
+			if f.ScoreColumn == 0 {
+				f.ScoreColumn = 2
+			}
+			if f.IPColumn < 1 || f.ScoreColumn < 1 || f.IPColumn == f.ScoreColumn {
+				return fmt.Errorf("feed %q: ip_column and score_column must be distinct and positive", f.Name)
+			}
+		default:
+			return fmt.Errorf("feed %q: unknown format %q", f.Name, f.Format)
+		}
+		if f.Score == 0 {
+			f.Score = 100
+		}
+		if f.Score < 0 || f.BanScore < 0 || f.BanDuration.Duration < 0 {
+			return fmt.Errorf("feed %q: values must not be negative", f.Name)
+		}
+	}
+	if c.ThreatIntel.CheckInterval.Duration < 0 {
+		return fmt.Errorf("threat_intel: check_interval must not be negative")
+	}
+
+	if rd := &c.ReverseDNS; rd.Enabled {
+		if rd.Workers < 1 || rd.Timeout.Duration <= 0 {
+			return fmt.Errorf("reverse_dns: workers and timeout must be positive")
+		}
+		if rd.MinTTL.Duration < 0 || rd.MaxTTL.Duration < 0 || rd.NegativeTTL.Duration < 0 {
+			return fmt.Errorf("reverse_dns: TTLs must not be negative")
+		}
+		for i, server := range rd.Servers {
+			if addr, err := netip.ParseAddr(server); err == nil {
+				rd.Servers[i] = netip.AddrPortFrom(addr, 53).String()
+			} else if _, err := netip.ParseAddrPort(server); err != nil {
+				return fmt.Errorf("reverse_dns: server %q is not an address or address:port", server)
+			}
+		}
+	}
+
+	if r := &c.Risk; r.Enabled {
+		if r.HalfLife.Duration <= 0 || r.PreAuthTimeout.Duration <= 0 || r.MaxTracked < 1 {
+			return fmt.Errorf("risk: half_life, preauth_timeout and max_tracked must be positive")
+		}
+		w := r.Weights
+		if w.Failure < 0 || w.NewUsername < 0 || w.ThreatFeed < 0 || w.GeoNovelty < 0 || w.PreAuthDisconnect < 0 || w.Connection < 0 {
+			return fmt.Errorf("risk: weights must not be negative")
+		}
+		for _, name := range r.PreAuthServices {
+			if !services[name] {
+				return fmt.Errorf("risk: preauth_services: unknown service %q", name)
+			}
+		}
+		bands := make(map[string]bool)
+		for i, b := range r.Bands {
+			if b.Name == "" {
+				return fmt.Errorf("risk: bands[%d]: name is required", i)
+			}
+			if bands[b.Name] {
+				return fmt.Errorf("risk: bands[%d]: duplicate name %q", i, b.Name)
+			}
+			bands[b.Name] = true
+
+			if b.Score <= 0 {
+				return fmt.Errorf("risk band %q: score must be positive", b.Name)
+			}
+			if i > 0 && b.Score <= r.Bands[i-1].Score {
+				return fmt.Errorf("risk band %q: bands must be listed by increasing score", b.Name)
+			}
+			switch b.Severity {
+			case "info", "warning", "critical":
+			default:
+				return fmt.Errorf("risk band %q: unknown severity %q", b.Name, b.Severity)
+			}
+			switch b.Action {
+			case ActionAlert, ActionBan:
+			default:
+				return fmt.Errorf("risk band %q: action must be %q or %q", b.Name, ActionAlert, ActionBan)
+			}
+			if b.BanDuration.Duration < 0 {
+				return fmt.Errorf("risk band %q: ban_duration must not be negative", b.Name)
+			}
+		}
+	}
+
+	if _, err := privdrop.ParseCapabilities(c.Privileges.Capabilities); err != nil {
+		return fmt.Errorf("privileges: %w", err)
+	}
+
+	var err error
+	if c.Forwarding.allowFrom, err = ParsePrefixes(c.Forwarding.AllowFrom); err != nil {
+		return fmt.Errorf("forwarding: allow_from: %w", err)
+	}
+	if c.Forwarding.denyFrom, err = ParsePrefixes(c.Forwarding.DenyFrom); err != nil {
+		return fmt.Errorf("forwarding: deny_from: %w", err)
+	}
+	return nil
+}
+
+// Violation returns why user may not forward from source, or "". The user
+// and the source are checked independently and deny lists take precedence,
+// so allow_users does not exempt a user from deny_from.
+func (p *ForwardingPolicy) Violation(user string, source netip.Addr) string {
+	for _, u := range p.DenyUsers {
+		if u == user {
+			return fmt.Sprintf("user %s is denied port forwarding", user)
+		}
+	}
+	if len(p.AllowUsers) > 0 {
+		allowed := false
+		for _, u := range p.AllowUsers {
+			if u == user {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("user %s is not allowed port forwarding", user)
+		}
+	}
+	if ContainsAddr(p.denyFrom, source) {
+		return fmt.Sprintf("port forwarding is denied from %s", source)
+	}
+	if len(p.allowFrom) > 0 && !ContainsAddr(p.allowFrom, source) {
+		return fmt.Sprintf("port forwarding is not allowed from %s", addrLabel(source))
+	}
+	return ""
+}
+
+func addrLabel(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return "an unknown address"
+	}
+	return addr.String()
+}
+
+func (g *GeoFence) CoversService(name string) bool {
+	return len(g.Services) == 0 || containsString(g.Services, name)
+}
+
+func (g *GeoFence) CoversPAMService(name string) bool {
+	return len(g.PAMServices) == 0 || containsString(g.PAMServices, name)
+}
+
+// Violation explains why addr, located in country and announced by asn,
+// breaks the policy, or returns "" when it is allowed. An empty country
+// and zero asn mean the GeoIP databases know nothing about addr.
+func (g *GeoFence) Violation(addr netip.Addr, country string, asn uint32) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || ContainsAddr(g.allowFrom, addr) {
+		return ""
+	}
+
+	for _, cc := range g.DenyCountries {
+		if strings.EqualFold(cc, country) {
+			return fmt.Sprintf("country %s is denied", country)
+		}
+	}
+	for _, n := range g.DenyASNs {
+		if n == asn {
+			return fmt.Sprintf("AS%d is denied", asn)
+		}
+	}
+
+	if len(g.AllowCountries) == 0 && len(g.AllowASNs) == 0 {
+		return ""
+	}
+	if country == "" && asn == 0 {
+		if g.AllowUnknown {
+			return ""
+		}
+		return "location is unknown"
+	}
+	for _, cc := range g.AllowCountries {
+		if strings.EqualFold(cc, country) {
+			return ""
+		}
+	}
+	for _, n := range g.AllowASNs {
+		if n == asn {
+			return ""
+		}
+	}
+	if country == "" {
+		country = "unknown"
+	}
+	return fmt.Sprintf("country %s / AS%d is not allowed", country, asn)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *OutboundPolicy) Matches(source netip.Addr, dest netip.Addr, destPort int) bool {
+	if len(p.sessionFrom) > 0 && !ContainsAddr(p.sessionFrom, source) {
+		return false
+	}
+	if len(p.sessionNotFrom) > 0 && ContainsAddr(p.sessionNotFrom, source) {
+		return false
+	}
+	if len(p.destinations) > 0 && !ContainsAddr(p.destinations, dest) {
+		return false
+	}
+	if len(p.DestinationPorts) > 0 {
+		for _, port := range p.DestinationPorts {
+			if port == destPort {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func ParsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func ContainsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PrivEsc) Covers(service string) bool {
+	for _, svc := range p.Services {
+		if svc == service {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) Service(localPort int, comm string, netnsName string) *Service {
+	for i := range c.Services {
+		svc := &c.Services[i]
+		if !svc.InNamespace(netnsName) {
+			continue
+		}
+		for _, port := range svc.Ports {
+			if port == localPort {
+				return svc
+			}
+		}
+		for _, proc := range svc.Processes {
+			if strings.EqualFold(proc, comm) {
+				return svc
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) MonitorsPAMService(name string) bool {
+	for _, svc := range c.PAMServices {
+		if svc == "*" || svc == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) InNamespace(netnsName string) bool {
+	if len(s.Namespaces) == 0 {
+		return true
+	}
+	for _, name := range s.Namespaces {
+		if name == netnsName {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) Namespace(inode uint64) *Namespace {
+	for i := range c.Namespaces {
+		if c.Namespaces[i].Inode == inode {
+			return &c.Namespaces[i]
+		}
+	}
+	return nil
+}
+
+func NetnsInode(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat netns %s: %w", path, err)
+	}
+	return st.Ino, nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Diff describes what changed between two configs, one line per named
+// item or section. Sections that are only read at startup are marked as
+// needing a restart.
+func Diff(prev, next *Config) []string {
+	var changes []string
+
+	changes = append(changes, diffNamed("namespace", namespaceMap(prev.Namespaces), namespaceMap(next.Namespaces))...)
+	changes = append(changes, diffNamed("service", serviceMap(prev.Services), serviceMap(next.Services))...)
+	changes = append(changes, diffNamed("outbound policy", outboundMap(prev.Outbound), outboundMap(next.Outbound))...)
+	changes = append(changes, diffNamed("sink", sinkMap(prev.Sinks), sinkMap(next.Sinks))...)
+	changes = append(changes, diffNamed("geofence policy", geoFenceMap(prev.GeoFences), geoFenceMap(next.GeoFences))...)
+
+	sections := []struct {
+		name       string
+		prev, next interface{}
+		restart    bool
+	}{
+		{"pam_services", prev.PAMServices, next.PAMServices, false},
+		{"privesc", prev.PrivEsc, next.PrivEsc, false},
+		{"forwarding", prev.Forwarding, next.Forwarding, false},
+		{"pipeline.stats_interval", prev.Pipeline.StatsInterval, next.Pipeline.StatsInterval, false},
+		{"pipeline.queue_size", prev.Pipeline.QueueSize, next.Pipeline.QueueSize, true},
+		{"pipeline.workers", prev.Pipeline.Workers, next.Pipeline.Workers, true},
+		{"pipeline.overflow", prev.Pipeline.Overflow, next.Pipeline.Overflow, true},
+		{"health.loss_threshold", prev.Health.LossThreshold, next.Health.LossThreshold, false},
+		{"health.check_interval", prev.Health.CheckInterval, next.Health.CheckInterval, false},
+		{"health.listen", prev.Health.Listen, next.Health.Listen, true},
+		{"geoip", prev.GeoIP, next.GeoIP, false},
+		{"threat_intel", prev.ThreatIntel, next.ThreatIntel, false},
+		{"reverse_dns", prev.ReverseDNS, next.ReverseDNS, true},
+		{"risk", prev.Risk, next.Risk, false},
+		{"control_socket", prev.ControlSocket, next.ControlSocket, true},
+		{"privileges", prev.Privileges, next.Privileges, true},
+	}
+	for _, s := range sections {
+		if equalJSON(s.prev, s.next) {
+			continue
+		}
+		line := fmt.Sprintf("%s changed: %s -> %s", s.name, compactJSON(s.prev), compactJSON(s.next))
+		if s.restart {
+			line += " (takes effect after restart)"
+		}
+		changes = append(changes, line)
+	}
+	return changes
+}
+
+func diffNamed(kind string, prev, next map[string]interface{}) []string {
+	var changes []string
+	for _, name := range sortedKeys(prev) {
+		n, ok := next[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s %q removed", kind, name))
+		} else if !equalJSON(prev[name], n) {
+			changes = append(changes, fmt.Sprintf("%s %q changed", kind, name))
+		}
+	}
+	for _, name := range sortedKeys(next) {
+		if _, ok := prev[name]; !ok {
+			changes = append(changes, fmt.Sprintf("%s %q added", kind, name))
+		}
+	}
+	return changes
+}
+
+func equalJSON(a, b interface{}) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func namespaceMap(items []Namespace) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for _, it := range items {
+		m[it.Name] = it
+	}
+	return m
+}
+
+func serviceMap(items []Service) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for _, it := range items {
+		m[it.Name] = it
+	}
+	return m
+}
+
+func outboundMap(items []OutboundPolicy) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for _, it := range items {
+		m[it.Name] = it
+	}
+	return m
+}
+
+func sinkMap(items []Sink) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for _, it := range items {
+		m[it.Name] = it
+	}
+	return m
+}
+
+func geoFenceMap(items []GeoFence) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for _, it := range items {
+		m[it.Name] = it
+	}
+	return m
+}
@@ -0,0 +1,220 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"secrds/internal/procfs"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// maxPaths bounds the cgroup ID cache; it is cleared when full.
+	maxPaths = 4096
+)
+
+var idPatterns = []struct {
+	runtime string
+	re      *regexp.Regexp
+}{
+	{"docker", regexp.MustCompile(`docker-([0-9a-f]{64})\.scope`)},
+	{"docker", regexp.MustCompile(`/docker/([0-9a-f]{64})`)},
+	{"containerd", regexp.MustCompile(`cri-containerd-([0-9a-f]{64})\.scope`)},
+	{"crio", regexp.MustCompile(`crio-(?:conmon-)?([0-9a-f]{64})\.scope`)},
+	{"podman", regexp.MustCompile(`libpod-(?:conmon-)?([0-9a-f]{64})\.scope`)},
+	{"podman", regexp.MustCompile(`/libpod_parent/libpod-([0-9a-f]{64})`)},
+	{"kubernetes", regexp.MustCompile(`/kubepods[^ ]*/pod[0-9a-f_-]+/([0-9a-f]{64})`)},
+}
+
+type Info struct {
+	CgroupID uint64
+	Path     string
+	Runtime  string
+	ID       string
+	Name     string
+}
+
+func (i Info) InContainer() bool {
+	return i.ID != ""
+}
+
+func (i Info) ShortID() string {
+	if len(i.ID) > 12 {
+		return i.ID[:12]
+	}
+	return i.ID
+}
+
+type Resolver struct {
+	proc  procfs.FS
+	root  string
+	mu    sync.RWMutex
+	paths map[uint64]string
+	names map[string]string
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		proc:  procfs.Host(),
+		root:  cgroupRoot,
+		paths: make(map[uint64]string),
+		names: make(map[string]string),
+	}
+}
+
+// SetProcFS replaces the procfs used to read /proc/<pid>/cgroup.
+func (r *Resolver) SetProcFS(fsys procfs.FS) {
+	r.proc = fsys
+}
+
+// Resolve finds the cgroup of an event. An unknown cgroup ID is looked up
+// through the cgroup tgid is in now, which is cached once its directory
+// inode confirms it is the cgroup the event came from.
+func (r *Resolver) Resolve(cgroupID uint64, tgid uint32) Info {
+	info := Info{CgroupID: cgroupID}
+
+	if cgroupID != 0 {
+		r.mu.RLock()
+		info.Path = r.paths[cgroupID]
+		r.mu.RUnlock()
+	}
+	if info.Path == "" && tgid != 0 {
+		if path, err := cgroupPathFromProc(r.proc, tgid); err == nil {
+			info.Path = path
+			if cgroupID != 0 && r.cgroupID(path) == cgroupID {
+				r.remember(cgroupID, path)
+			}
+		}
+	}
+	if info.Path == "" {
+		return info
+	}
+
+	info.Runtime, info.ID = ParseContainerID(info.Path)
+	if info.ID != "" {
+		info.Name = r.lookupName(info.Runtime, info.ID)
+	}
+	return info
+}
+
+// cgroupID returns the ID of the cgroup at path, which on cgroup v2 is the
+// inode number of its directory, or 0 if it cannot be read.
+func (r *Resolver) cgroupID(path string) uint64 {
+	fi, err := os.Stat(filepath.Join(r.root, path))
+	if err != nil {
+		return 0
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return st.Ino
+}
+
+func (r *Resolver) remember(cgroupID uint64, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.paths) >= maxPaths {
+		r.paths = make(map[uint64]string)
+	}
+	r.paths[cgroupID] = path
+}
+
+func (r *Resolver) lookupName(runtime, id string) string {
+	key := runtime + "/" + id
+	r.mu.RLock()
+	name, ok := r.names[key]
+	r.mu.RUnlock()
+	if ok {
+		return name
+	}
+
+	switch runtime {
+	case "docker":
+		name = dockerName(id)
+	case "podman":
+		name = podmanName(id)
+	}
+
+	r.mu.Lock()
+	r.names[key] = name
+	r.mu.Unlock()
+	return name
+}
+
+func ParseContainerID(cgroupPath string) (string, string) {
+	for _, p := range idPatterns {
+		if m := p.re.FindStringSubmatch(cgroupPath); m != nil {
+			return p.runtime, m[1]
+		}
+	}
+	return "", ""
+}
+
+func cgroupPathFromProc(fsys procfs.FS, tgid uint32) (string, error) {
+	data, err := fsys.ReadFile(procfs.PidPath(tgid, "cgroup"))
+	if err != nil {
+		return "", err
+	}
+
+	var fallback string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2], nil
+		}
+		if fallback == "" || strings.Contains(parts[1], "name=systemd") {
+			fallback = parts[2]
+		}
+	}
+	if fallback == "" {
+		return "", fmt.Errorf("no cgroup entry for PID %d", tgid)
+	}
+	return fallback, nil
+}
+
+func dockerName(id string) string {
+	data, err := os.ReadFile(filepath.Join("/var/lib/docker/containers", id, "config.v2.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg struct {
+		Name string `json:"Name"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(cfg.Name, "/")
+}
+
+func podmanName(id string) string {
+	data, err := os.ReadFile("/var/lib/containers/storage/overlay-containers/containers.json")
+	if err != nil {
+		return ""
+	}
+	var containers []struct {
+		ID    string   `json:"id"`
+		Names []string `json:"names"`
+	}
+	if err := json.Unmarshal(data, &containers); err != nil {
+		return ""
+	}
+	for _, c := range containers {
+		if c.ID == id && len(c.Names) > 0 {
+			return c.Names[0]
+		}
+	}
+	return ""
+}
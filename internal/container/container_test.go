@@ -0,0 +1,99 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"secrds/internal/procfs/procfstest"
+)
+
+var (
+	id1 = strings.Repeat("0123456789abcdef", 4)
+	id2 = strings.Repeat("fedcba9876543210", 4)
+)
+
+func TestParseContainerID(t *testing.T) {
+	tests := []struct {
+		path, runtime, id string
+	}{
+		{"/system.slice/docker-" + id1 + ".scope", "docker", id1},
+		{"/docker/" + id1, "docker", id1},
+		{"/docker/" + id1 + "/init.scope", "docker", id1},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0d1e_2f3a.slice/cri-containerd-" + id1 + ".scope", "containerd", id1},
+		{"/kubepods.slice/kubepods-pod0d1e.slice/crio-" + id1 + ".scope", "crio", id1},
+		{"/kubepods.slice/kubepods-pod0d1e.slice/crio-conmon-" + id1 + ".scope", "crio", id1},
+		{"/kubepods/besteffort/pod0d1e2f3a-4b5c-6d7e-8f90-a1b2c3d4e5f6/" + id2, "kubernetes", id2},
+		{"/machine.slice/libpod-" + id1 + ".scope", "podman", id1},
+		{"/machine.slice/libpod-conmon-" + id1 + ".scope", "podman", id1},
+		{"/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id2 + ".scope/container", "podman", id2},
+		{"/libpod_parent/libpod-" + id1, "podman", id1},
+		{"/user.slice/user-1000.slice/session-3.scope", "", ""},
+		{"/system.slice/sshd.service", "", ""},
+		{"/system.slice/docker.service", "", ""},
+		{"/system.slice/docker-" + id1[:12] + ".scope", "", ""},
+		{"/system.slice/docker-" + strings.ToUpper(id1) + ".scope", "", ""},
+		{"/", "", ""},
+	}
+	for _, tc := range tests {
+		runtime, id := ParseContainerID(tc.path)
+		if runtime != tc.runtime || id != tc.id {
+			t.Errorf("%s: got %q %q, want %q %q", tc.path, runtime, id, tc.runtime, tc.id)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	scope := "/system.slice/docker-" + id1 + ".scope"
+	session := "/user.slice/user-1000.slice/session-3.scope"
+	for _, dir := range []string{scope, session} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ino := func(dir string) uint64 {
+		fi, err := os.Stat(filepath.Join(root, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Sys().(*syscall.Stat_t).Ino
+	}
+
+	fsys := procfstest.New()
+	fsys.AddFile("42/cgroup", "0::"+scope+"\n")
+	fsys.AddFile("43/cgroup", "12:pids:/user.slice\n1:name=systemd:"+session+"\n")
+	fsys.AddFile("44/cgroup", "0::"+session+"\n")
+
+	r := NewResolver()
+	r.root = root
+	r.SetProcFS(fsys)
+
+	info := r.Resolve(ino(scope), 42)
+	if info.Path != scope || info.Runtime != "docker" || info.ID != id1 || !info.InContainer() || info.ShortID() != id1[:12] {
+		t.Fatalf("docker scope: %+v", info)
+	}
+	// Confirmed IDs are cached, so the process is no longer needed.
+	if info := r.Resolve(ino(scope), 0); info.Path != scope {
+		t.Fatalf("cached scope: %+v", info)
+	}
+
+	if info := r.Resolve(ino(session), 43); info.Path != session || info.InContainer() {
+		t.Fatalf("cgroup v1 session: %+v", info)
+	}
+
+	// PID 44 moved to another cgroup after the event: its current cgroup is
+	// reported but not cached under the event's ID.
+	if info := r.Resolve(ino(scope)+1000, 44); info.Path != session {
+		t.Fatalf("moved process: %+v", info)
+	}
+	if info := r.Resolve(ino(scope)+1000, 0); info.Path != "" {
+		t.Fatalf("unconfirmed ID cached: %+v", info)
+	}
+
+	if info := r.Resolve(0, 99); info.Path != "" || info.CgroupID != 0 {
+		t.Fatalf("unknown process: %+v", info)
+	}
+}
@@ -0,0 +1,147 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"secrds/internal/logger"
+)
+
+const DefaultPath = "/run/secrds/control.sock"
+
+type Handler func(args []string) (interface{}, error)
+
+type Response struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+type Server struct {
+	path     string
+	logger   *logger.Logger
+	listener net.Listener
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+}
+
+func NewServer(path string, logger *logger.Logger) *Server {
+	return &Server{
+		path:     path,
+		logger:   logger,
+		handlers: make(map[string]Handler),
+	}
+}
+
+func (s *Server) Handle(command string, h Handler) {
+	s.mu.Lock()
+	s.handlers[command] = h
+	s.mu.Unlock()
+}
+
+func (s *Server) Start() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return fmt.Errorf("failed to create control socket directory: %w", err)
+	}
+	os.Remove(s.path)
+
+	l, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s.listener = l
+	s.wg.Add(1)
+	go s.serve()
+	return nil
+}
+
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+
+	fields := strings.Fields(line)
+	resp := Response{}
+	if len(fields) == 0 {
+		resp.Error = "empty command"
+	} else {
+		s.mu.RLock()
+		h, ok := s.handlers[fields[0]]
+		s.mu.RUnlock()
+
+		if !ok {
+			resp.Error = fmt.Sprintf("unknown command %q", fields[0])
+		} else if result, err := h(fields[1:]); err != nil {
+			s.logger.LogError("Control command %s failed: %v", fields[0], err)
+			resp.Error = err.Error()
+		} else if data, err := json.Marshal(result); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.OK = true
+			resp.Result = data
+		}
+	}
+
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func Call(path string, command string, args ...string) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket %s: %w", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	line := strings.Join(append([]string{command}, args...), " ")
+	if _, err := fmt.Fprintln(conn, line); err != nil {
+		return nil, fmt.Errorf("failed to send command: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Result, nil
+}
@@ -0,0 +1,268 @@
+package doctor
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/features"
+	"golang.org/x/sys/unix"
+
+	"secrds/internal/pamlib"
+	"secrds/internal/procfs"
+)
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarn    Status = "warn"
+	StatusMissing Status = "missing"
+	StatusUnknown Status = "unknown"
+)
+
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Checks []Check `json:"checks"`
+	Plan   Plan    `json:"plan"`
+}
+
+type Options struct {
+	AcceptObject string
+	AuthObject   string
+	ExecObject   string
+	Proc         procfs.FS
+}
+
+var tracefsRoots = []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"}
+
+// Run probes the kernel and userland for everything secrds can use and
+// derives the per-feature plan from the results.
+func Run(opts Options) Report {
+	if opts.Proc == nil {
+		opts.Proc = procfs.Host()
+	}
+
+	var r Report
+	add := func(c Check) { r.Checks = append(r.Checks, c) }
+
+	add(kernelCheck())
+	add(privilegeCheck())
+	add(memlockCheck())
+	add(btfCheck())
+	add(programCheck("kprobe programs", ebpf.Kprobe))
+	add(pmuCheck("kprobe attach", "kprobe", "kprobe_events"))
+	add(pmuCheck("uprobe attach", "uprobe", "uprobe_events"))
+	add(programCheck("tracepoint programs", ebpf.TracePoint))
+	add(tracepointCheck("sched", "sched_process_exec"))
+	add(tracepointCheck("syscalls", "sys_enter_execve"))
+	add(tracepointCheck("syscalls", "sys_exit_accept4"))
+	add(tracepointCheck("sock", "inet_sock_set_state"))
+	add(fentryCheck())
+	add(mapCheck("perf event array", ebpf.PerfEventArray))
+	add(mapCheck("ring buffer", ebpf.RingBuf))
+	add(programCheck("XDP", ebpf.XDP))
+	add(sockDiagCheck())
+	add(cgroupCheck())
+	add(objectCheck("accept object", opts.AcceptObject))
+	add(objectCheck("auth object", opts.AuthObject))
+	add(objectCheck("exec object", opts.ExecObject))
+	r.Checks = append(r.Checks, libpamChecks(opts.Proc)...)
+	r.Checks = append(r.Checks, sshdChecks(opts.Proc)...)
+
+	r.Plan = planFor(r.Checks)
+	return r
+}
+
+func (r Report) Status(name string) Status {
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c.Status
+		}
+	}
+	return StatusUnknown
+}
+
+func kernelCheck() Check {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return Check{"kernel", StatusUnknown, err.Error()}
+	}
+	return Check{"kernel", StatusOK, unix.ByteSliceToString(uts.Release[:]) + " " + unix.ByteSliceToString(uts.Machine[:])}
+}
+
+func privilegeCheck() Check {
+	if os.Geteuid() == 0 {
+		return Check{"privileges", StatusOK, "running as root"}
+	}
+	return Check{"privileges", StatusWarn, fmt.Sprintf("running as uid %d; BPF probes below may report unknown", os.Geteuid())}
+}
+
+func memlockCheck() Check {
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &lim); err != nil {
+		return Check{"memlock", StatusUnknown, err.Error()}
+	}
+	if lim.Cur == unix.RLIM_INFINITY {
+		return Check{"memlock", StatusOK, "unlimited"}
+	}
+	// Kernels from 5.11 charge BPF memory to the cgroup instead.
+	if major, minor, ok := kernelVersion(); ok && (major > 5 || major == 5 && minor >= 11) {
+		return Check{"memlock", StatusOK, fmt.Sprintf("%d KiB, not used for BPF memory on this kernel", lim.Cur>>10)}
+	}
+	return Check{"memlock", StatusWarn, fmt.Sprintf("%d KiB; secrds raises it at startup, which needs CAP_SYS_RESOURCE", lim.Cur>>10)}
+}
+
+func kernelVersion() (int, int, bool) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return 0, 0, false
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(unix.ByteSliceToString(uts.Release[:]), "%d.%d", &major, &minor); err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+func btfCheck() Check {
+	if _, err := btf.LoadKernelSpec(); err != nil {
+		return Check{"BTF", StatusMissing, err.Error()}
+	}
+	return Check{"BTF", StatusOK, "/sys/kernel/btf/vmlinux"}
+}
+
+func featureStatus(name string, err error) Check {
+	switch {
+	case err == nil:
+		return Check{name, StatusOK, ""}
+	case errors.Is(err, ebpf.ErrNotSupported):
+		return Check{name, StatusMissing, err.Error()}
+	}
+	return Check{name, StatusUnknown, err.Error()}
+}
+
+func programCheck(name string, pt ebpf.ProgramType) Check {
+	return featureStatus(name, features.HaveProgramType(pt))
+}
+
+func mapCheck(name string, mt ebpf.MapType) Check {
+	return featureStatus(name, features.HaveMapType(mt))
+}
+
+// pmuCheck reports how probes of one kind can be created: through the
+// perf PMU (4.17+) or the legacy tracefs interface.
+func pmuCheck(name, pmu, eventsFile string) Check {
+	if _, err := os.Stat(filepath.Join("/sys/bus/event_source/devices", pmu, "type")); err == nil {
+		return Check{name, StatusOK, "perf PMU"}
+	}
+	for _, root := range tracefsRoots {
+		if _, err := os.Stat(filepath.Join(root, eventsFile)); err == nil {
+			return Check{name, StatusWarn, "legacy tracefs " + filepath.Join(root, eventsFile)}
+		}
+	}
+	return Check{name, StatusMissing, "no " + pmu + " PMU and no tracefs " + eventsFile}
+}
+
+func tracepointCheck(group, name string) Check {
+	label := "tracepoint " + group + "/" + name
+	mounted := false
+	for _, root := range tracefsRoots {
+		if _, err := os.Stat(filepath.Join(root, "events")); err != nil {
+			continue
+		}
+		mounted = true
+		if _, err := os.Stat(filepath.Join(root, "events", group, name, "id")); err == nil {
+			return Check{label, StatusOK, ""}
+		}
+	}
+	if !mounted {
+		return Check{label, StatusUnknown, "tracefs is not mounted"}
+	}
+	return Check{label, StatusMissing, "not present in tracefs"}
+}
+
+func fentryCheck() Check {
+	c := featureStatus("fentry", features.HaveProgramType(ebpf.Tracing))
+	if c.Status != StatusOK {
+		return c
+	}
+	if _, err := btf.LoadKernelSpec(); err != nil {
+		return Check{"fentry", StatusMissing, "needs kernel BTF"}
+	}
+	return c
+}
+
+func sockDiagCheck() Check {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return Check{"sock_diag", StatusMissing, err.Error()}
+	}
+	unix.Close(fd)
+	return Check{"sock_diag", StatusOK, ""}
+}
+
+func cgroupCheck() Check {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		return Check{"cgroup v2", StatusOK, "/sys/fs/cgroup"}
+	}
+	return Check{"cgroup v2", StatusWarn, "not mounted at /sys/fs/cgroup; container IDs come from /proc/<pid>/cgroup"}
+}
+
+func objectCheck(name, path string) Check {
+	f, err := elf.Open(path)
+	if err != nil {
+		return Check{name, StatusMissing, err.Error()}
+	}
+	defer f.Close()
+	if f.Machine != elf.EM_BPF {
+		return Check{name, StatusMissing, fmt.Sprintf("not a BPF object (%s)", f.Machine)}
+	}
+	if f.ByteOrder.Uint16([]byte{1, 0}) != binary.NativeEndian.Uint16([]byte{1, 0}) {
+		return Check{name, StatusMissing, "built for the other byte order"}
+	}
+	return Check{name, StatusOK, path}
+}
+
+func libpamChecks(fsys procfs.FS) []Check {
+	libs := pamlib.Discover(fsys, []string{"sshd", "sshd-session"})
+	if len(libs) == 0 {
+		return []Check{{"libpam", StatusMissing, "no " + pamlib.Soname + " found"}}
+	}
+
+	var checks []Check
+	for _, lib := range libs {
+		name := "libpam " + lib.Path
+		syms, err := pamlib.ReadSymbols(lib.Path, pamlib.Functions...)
+		if err != nil {
+			checks = append(checks, Check{name, StatusMissing, err.Error()})
+			continue
+		}
+		var missing []string
+		for _, fn := range pamlib.Functions {
+			if _, ok := syms[fn]; !ok {
+				missing = append(missing, fn)
+			}
+		}
+		switch {
+		case len(missing) == len(pamlib.Functions):
+			checks = append(checks, Check{name, StatusMissing, "no PAM entry points exported"})
+		case len(missing) > 0:
+			checks = append(checks, Check{name, StatusWarn, "found via " + lib.Source + ", missing " + strings.Join(missing, ", ")})
+		default:
+			checks = append(checks, Check{name, StatusOK, "found via " + lib.Source})
+		}
+	}
+	return checks
+}
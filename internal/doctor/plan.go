@@ -0,0 +1,89 @@
+package doctor
+
+import "strings"
+
+const Disabled = "disabled"
+
+// Plan is the mechanism secrds uses for each feature on this host, or
+// Disabled when a prerequisite is missing.
+type Plan struct {
+	Accept       string `json:"accept"`
+	Auth         string `json:"auth"`
+	Exec         string `json:"exec"`
+	Connect      string `json:"connect"`
+	SocketLookup string `json:"socket_lookup"`
+	Containers   string `json:"containers"`
+}
+
+// Degraded lists the monitoring features the plan disables.
+func (p Plan) Degraded() []string {
+	var off []string
+	for _, f := range []struct{ name, how string }{
+		{"accept", p.Accept},
+		{"auth", p.Auth},
+		{"exec", p.Exec},
+		{"connect", p.Connect},
+	} {
+		if f.how == Disabled {
+			off = append(off, f.name)
+		}
+	}
+	return off
+}
+
+// Monitoring reports whether any connection or login signal is available.
+func (p Plan) Monitoring() bool {
+	return p.Accept != Disabled || p.Auth != Disabled
+}
+
+// planFor turns check results into a plan. Only a definite "missing"
+// disables a feature: probes that could not be run (for example without
+// root) are assumed to work and fail later at load time. Accept is the only
+// feature with a second mechanism; the fentry, ring buffer and XDP checks
+// are informational and no plan uses them.
+func planFor(checks []Check) Plan {
+	status := make(map[string]Status, len(checks))
+	libpam := false
+	for _, c := range checks {
+		status[c.Name] = c.Status
+		if strings.HasPrefix(c.Name, "libpam") && (c.Status == StatusOK || c.Status == StatusWarn) {
+			libpam = true
+		}
+	}
+	avail := func(names ...string) bool {
+		for _, n := range names {
+			if status[n] == StatusMissing {
+				return false
+			}
+		}
+		return true
+	}
+	pick := func(ok bool, how string) string {
+		if ok {
+			return how
+		}
+		return Disabled
+	}
+
+	events := avail("perf event array")
+	p := Plan{
+		Accept:       pick(events && avail("accept object"), "kretprobe"),
+		Auth:         pick(events && libpam && avail("uprobe attach", "auth object"), "uprobe"),
+		Exec:         pick(events && avail("tracepoint programs", "tracepoint sched/sched_process_exec", "tracepoint syscalls/sys_enter_execve", "exec object"), "tracepoint"),
+		SocketLookup: pick(avail("sock_diag"), "sock_diag"),
+		Containers:   "cgroup v2",
+	}
+	// Without kprobes, accept falls back to the syscall tracepoints and
+	// resolves each new fd through /proc.
+	if p.Accept != Disabled && !avail("kprobe programs", "kprobe attach") {
+		p.Accept = pick(avail("tracepoint programs", "tracepoint syscalls/sys_exit_accept4"), "tracepoint")
+	}
+	p.Connect = pick(p.Exec != Disabled && avail("tracepoint sock/inet_sock_set_state"), "tracepoint")
+	if p.SocketLookup == Disabled {
+		p.SocketLookup = "procfs"
+	}
+	if status["cgroup v2"] != StatusOK {
+		p.Containers = "proc cgroup"
+	}
+	return p
+}
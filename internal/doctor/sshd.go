@@ -0,0 +1,106 @@
+package doctor
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"secrds/internal/pamlib"
+	"secrds/internal/procfs"
+)
+
+var sshdPaths = []string{
+	"/usr/sbin/sshd",
+	"/usr/bin/sshd",
+	"/usr/local/sbin/sshd",
+	"/usr/lib/openssh/sshd-session",
+	"/usr/libexec/openssh/sshd-session",
+	"/usr/libexec/sshd-session",
+}
+
+// sshdChecks inspects the sshd binaries secrds will see: whether they run,
+// match the host architecture and load libpam dynamically, which is what
+// the PAM uprobes rely on.
+func sshdChecks(fsys procfs.FS) []Check {
+	running, exes := runningSSHD(fsys)
+
+	var checks []Check
+	if running == 0 {
+		checks = append(checks, Check{"sshd processes", StatusWarn, "none running"})
+	} else {
+		checks = append(checks, Check{"sshd processes", StatusOK, fmt.Sprintf("%d running", running)})
+	}
+
+	found := 0
+	seen := make(map[string]bool)
+	for _, path := range append(exes, sshdPaths...) {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		checks = append(checks, binaryCheck(path))
+		found++
+	}
+	if found == 0 {
+		checks = append(checks, Check{"sshd binary", StatusWarn, "not found in standard locations"})
+	}
+	return checks
+}
+
+func runningSSHD(fsys procfs.FS) (int, []string) {
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		return 0, nil
+	}
+
+	count := 0
+	var exes []string
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		comm, err := fsys.ReadFile(procfs.PidPath(uint32(pid), "comm"))
+		if err != nil {
+			continue
+		}
+		if c := strings.TrimSpace(string(comm)); c != "sshd" && c != "sshd-session" {
+			continue
+		}
+		count++
+		if exe, err := fsys.Readlink(procfs.PidPath(uint32(pid), "exe")); err == nil {
+			exes = append(exes, strings.TrimSuffix(exe, " (deleted)"))
+		}
+	}
+	return count, exes
+}
+
+func binaryCheck(path string) Check {
+	name := "binary " + path
+	f, err := elf.Open(path)
+	if err != nil {
+		return Check{name, StatusWarn, err.Error()}
+	}
+	defer f.Close()
+
+	if _, err := pamlib.ReadSymbols(path); errors.Is(err, pamlib.ErrWrongArch) {
+		return Check{name, StatusWarn, fmt.Sprintf("built for %s", f.Machine)}
+	}
+
+	libs, err := f.ImportedLibraries()
+	if err != nil || len(libs) == 0 {
+		return Check{name, StatusWarn, "statically linked; PAM uprobes only see dynamically loaded libpam"}
+	}
+	for _, lib := range libs {
+		if strings.HasPrefix(lib, "libpam.so") {
+			return Check{name, StatusOK, fmt.Sprintf("%s, links %s", f.Machine, lib)}
+		}
+	}
+	return Check{name, StatusWarn, "does not link libpam; logins through it are not seen by the PAM probes"}
+}
@@ -0,0 +1,272 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"secrds/internal/config"
+	"secrds/internal/logger"
+)
+
+// cacheSize bounds the per-address cache; it is emptied when full and on
+// every database reload.
+const cacheSize = 8192
+
+// Info is what the configured databases know about one address. Country,
+// city and ASN data may come from different files.
+type Info struct {
+	CountryCode string `json:"country,omitempty"`
+	Country     string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint32 `json:"asn,omitempty"`
+	Org         string `json:"as_org,omitempty"`
+}
+
+// Fields returns the known attributes as log fields, skipping empty ones.
+func (i Info) Fields() []logger.Field {
+	var fields []logger.Field
+	if i.CountryCode != "" {
+		fields = append(fields, logger.F("country", i.CountryCode))
+	}
+	if i.City != "" {
+		fields = append(fields, logger.F("city", i.City))
+	}
+	if i.ASN != 0 {
+		fields = append(fields, logger.F("asn", fmt.Sprintf("AS%d", i.ASN)))
+	}
+	if i.Org != "" {
+		fields = append(fields, logger.F("as_org", i.Org))
+	}
+	return fields
+}
+
+type database struct {
+	path  string
+	db    *Database
+	mtime time.Time
+	size  int64
+}
+
+// Enricher looks addresses up in local MMDB files (MaxMind GeoIP2/GeoLite2
+// or DB-IP) and reopens a file when its modification time or size changes.
+// Nothing is ever fetched over the network.
+type Enricher struct {
+	logger *logger.Logger
+	dbs    atomic.Pointer[[]*database]
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+
+	cacheMu sync.Mutex
+	cache   map[netip.Addr]Info
+}
+
+func NewEnricher(lg *logger.Logger) *Enricher {
+	e := &Enricher{logger: lg, cache: make(map[netip.Addr]Info)}
+	e.dbs.Store(&[]*database{})
+	return e
+}
+
+// Configure opens every database in cfg and replaces the current set. The
+// current set stays in place when any file fails to open.
+func (e *Enricher) Configure(cfg config.GeoIP) error {
+	apply, err := e.Prepare(cfg)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare opens every database in cfg. The returned function replaces the
+// current set with them and restarts the file watcher.
+func (e *Enricher) Prepare(cfg config.GeoIP) (func(), error) {
+	dbs := make([]*database, 0, len(cfg.Databases))
+	for _, path := range cfg.Databases {
+		d, err := openDatabase(path)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, d)
+	}
+
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.stopWatcher()
+		e.swap(dbs)
+		for _, d := range dbs {
+			e.logger.LogInfo("Loaded GeoIP database %s (%s, built %s)", d.path, d.db.DatabaseType,
+				time.Unix(int64(d.db.BuildEpoch), 0).UTC().Format("2006-01-02"))
+		}
+
+		if len(dbs) > 0 && cfg.CheckInterval.Duration > 0 {
+			e.stop = make(chan struct{})
+			e.done = make(chan struct{})
+			go e.watch(cfg.CheckInterval.Duration, e.stop, e.done)
+		}
+	}, nil
+}
+
+func (e *Enricher) Close() {
+	e.mu.Lock()
+	e.stopWatcher()
+	e.mu.Unlock()
+}
+
+func (e *Enricher) stopWatcher() {
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop, e.done = nil, nil
+}
+
+func (e *Enricher) swap(dbs []*database) {
+	e.dbs.Store(&dbs)
+	e.cacheMu.Lock()
+	e.cache = make(map[netip.Addr]Info)
+	e.cacheMu.Unlock()
+}
+
+func openDatabase(path string) (*database, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	return &database{path: path, db: db, mtime: st.ModTime(), size: st.Size()}, nil
+}
+
+// watch reopens databases that changed on disk. A file that fails to parse,
+// for example because it is still being written, keeps its previous
+// contents and is retried on the next tick.
+func (e *Enricher) watch(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Each broken version of a file is reported once.
+	reported := make(map[string]string)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := *e.dbs.Load()
+		next := make([]*database, len(current))
+		changed := false
+		for i, d := range current {
+			next[i] = d
+			st, err := os.Stat(d.path)
+			if err != nil || (st.ModTime().Equal(d.mtime) && st.Size() == d.size) {
+				continue
+			}
+			version := fmt.Sprintf("%d/%d", st.ModTime().UnixNano(), st.Size())
+			if reported[d.path] == version {
+				continue
+			}
+			reopened, err := openDatabase(d.path)
+			if err != nil {
+				e.logger.LogError("Keeping previous GeoIP database: %v", err)
+				reported[d.path] = version
+				continue
+			}
+			delete(reported, d.path)
+			e.logger.LogInfo("Reloaded GeoIP database %s (%s)", d.path, reopened.db.DatabaseType)
+			next[i] = reopened
+			changed = true
+		}
+		if changed {
+			e.swap(next)
+		}
+	}
+}
+
+// Lookup merges what every configured database knows about addr; earlier
+// databases win for fields more than one of them provides.
+func (e *Enricher) Lookup(addr netip.Addr) Info {
+	if e == nil || !addr.IsValid() {
+		return Info{}
+	}
+	addr = addr.Unmap()
+	dbs := *e.dbs.Load()
+	if len(dbs) == 0 || addr.IsLoopback() || addr.IsPrivate() {
+		return Info{}
+	}
+
+	e.cacheMu.Lock()
+	info, ok := e.cache[addr]
+	e.cacheMu.Unlock()
+	if ok {
+		return info
+	}
+
+	for _, d := range dbs {
+		rec, err := d.db.Lookup(addr)
+		if err != nil {
+			e.logger.LogError("GeoIP lookup of %s in %s failed: %v", addr, d.path, err)
+			continue
+		}
+		if rec != nil {
+			info.merge(rec)
+		}
+	}
+
+	e.cacheMu.Lock()
+	if len(e.cache) >= cacheSize {
+		e.cache = make(map[netip.Addr]Info)
+	}
+	e.cache[addr] = info
+	e.cacheMu.Unlock()
+	return info
+}
+
+// Enabled reports whether at least one database is loaded.
+func (e *Enricher) Enabled() bool {
+	return e != nil && len(*e.dbs.Load()) > 0
+}
+
+func (i *Info) merge(rec map[string]interface{}) {
+	country := mapOf(rec["country"])
+	if country == nil {
+		country = mapOf(rec["registered_country"])
+	}
+	if i.CountryCode == "" {
+		i.CountryCode = stringOf(country["iso_code"])
+	}
+	if i.Country == "" {
+		i.Country = englishName(country)
+	}
+	if i.City == "" {
+		i.City = englishName(mapOf(rec["city"]))
+	}
+	if i.ASN == 0 {
+		i.ASN = uint32(uintOf(rec["autonomous_system_number"]))
+	}
+	if i.Org == "" {
+		i.Org = stringOf(rec["autonomous_system_organization"])
+	}
+}
+
+func englishName(m map[string]interface{}) string {
+	return stringOf(mapOf(m["names"])["en"])
+}
+
+func mapOf(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
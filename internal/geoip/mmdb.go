@@ -0,0 +1,362 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of every MaxMind DB
+// file (MaxMind GeoIP2/GeoLite2 and DB-IP use the same format).
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+const (
+	dataSeparator = 16
+	maxDepth      = 32
+)
+
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB file")
+
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint
+	RecordSize   uint
+	NodeCount    uint
+	BuildEpoch   uint64
+}
+
+// Database is an MMDB file read fully into memory, so a replaced or
+// truncated file on disk never affects lookups in progress.
+type Database struct {
+	Metadata
+	tree      []byte
+	data      []byte
+	ipv4Start uint
+}
+
+func Open(path string) (*Database, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := parseDatabase(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+func parseDatabase(buf []byte) (*Database, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata marker not found", ErrInvalidDatabase)
+	}
+	metaStart := i + len(metadataMarker)
+	raw, _, err := decoder{buf: buf[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+	meta, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	db := &Database{Metadata: Metadata{
+		DatabaseType: stringOf(meta["database_type"]),
+		IPVersion:    uint(uintOf(meta["ip_version"])),
+		RecordSize:   uint(uintOf(meta["record_size"])),
+		NodeCount:    uint(uintOf(meta["node_count"])),
+		BuildEpoch:   uintOf(meta["build_epoch"]),
+	}}
+	switch db.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, db.RecordSize)
+	}
+	if db.IPVersion != 4 && db.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidDatabase, db.IPVersion)
+	}
+
+	treeSize := db.NodeCount * db.RecordSize / 4
+	if treeSize+dataSeparator > uint(i) {
+		return nil, fmt.Errorf("%w: search tree of %d nodes does not fit", ErrInvalidDatabase, db.NodeCount)
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+dataSeparator : i]
+
+	if db.IPVersion == 6 {
+		node := uint(0)
+		for bit := 0; bit < 96 && node < db.NodeCount; bit++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (0) or right (1) record of a search tree node.
+func (db *Database) record(node uint, side uint) uint {
+	switch db.RecordSize {
+	case 24:
+		b := db.tree[node*6+side*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if side == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+	return uint(binary.BigEndian.Uint32(db.tree[node*8+side*4:]))
+}
+
+// offset walks the search tree for addr and returns the position of its
+// record in the data section.
+func (db *Database) offset(addr netip.Addr) (uint, bool) {
+	addr = addr.Unmap()
+	var bits []byte
+	node := uint(0)
+	switch {
+	case addr.Is4() && db.IPVersion == 6:
+		a := addr.As4()
+		bits, node = a[:], db.ipv4Start
+	case addr.Is4():
+		a := addr.As4()
+		bits = a[:]
+	case db.IPVersion == 6:
+		a := addr.As16()
+		bits = a[:]
+	default:
+		return 0, false
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.NodeCount; i++ {
+		node = db.record(node, uint(bits[i/8]>>(7-i%8))&1)
+	}
+	if node <= db.NodeCount {
+		return 0, false
+	}
+	off := node - db.NodeCount - dataSeparator
+	if off >= uint(len(db.data)) {
+		return 0, false
+	}
+	return off, true
+}
+
+// Lookup decodes the record for addr. It returns nil without an error when
+// the database has no entry for the address.
+func (db *Database) Lookup(addr netip.Addr) (map[string]interface{}, error) {
+	off, ok := db.offset(addr)
+	if !ok {
+		return nil, nil
+	}
+	v, _, err := decoder{buf: db.data}.decode(off, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: record at %d is not a map", ErrInvalidDatabase, off)
+	}
+	return m, nil
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder reads the MaxMind DB data section format. Every read is bounds
+// checked and nesting is limited, since the files come from outside.
+type decoder struct {
+	buf []byte
+}
+
+var errTruncated = fmt.Errorf("%w: truncated data", ErrInvalidDatabase)
+
+func (d decoder) bytes(off, n uint) ([]byte, error) {
+	if off > uint(len(d.buf)) || n > uint(len(d.buf))-off {
+		return nil, errTruncated
+	}
+	return d.buf[off : off+n], nil
+}
+
+func (d decoder) decode(off uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: data nested too deeply", ErrInvalidDatabase)
+	}
+	b, err := d.bytes(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	off++
+
+	typ := uint(ctrl >> 5)
+	if typ == typePointer {
+		target, next, err := d.pointer(ctrl, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target, depth+1)
+		return v, next, err
+	}
+	if typ == typeExtended {
+		if b, err = d.bytes(off, 1); err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+		off++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, err = d.bytes(off, n); err != nil {
+			return nil, 0, err
+		}
+		off += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidDatabase)
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			off = next
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]interface{}, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	case typeContainer, typeEndMarker:
+		return nil, off, nil
+	}
+
+	b, err = d.bytes(off, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	off += size
+
+	switch typ {
+	case typeString:
+		return string(b), off, nil
+	case typeBytes:
+		return append([]byte(nil), b...), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of %d bytes", ErrInvalidDatabase, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of %d bytes", ErrInvalidDatabase, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: integer of %d bytes", ErrInvalidDatabase, size)
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if typ == typeInt32 {
+			return int64(int32(uint32(v))), off, nil
+		}
+		return v, off, nil
+	case typeUint128:
+		// Not used by any field secrds reads; keep the raw bytes.
+		return append([]byte(nil), b...), off, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown data type %d", ErrInvalidDatabase, typ)
+}
+
+// pointer decodes the pointer whose control byte is ctrl and returns its
+// target and the offset following it.
+func (d decoder) pointer(ctrl byte, off uint) (uint, uint, error) {
+	n := uint(ctrl>>3&0x3) + 1
+	b, err := d.bytes(off, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	v := uint(ctrl & 0x7)
+	var target uint
+	switch n {
+	case 1:
+		target = v<<8 | uint(b[0])
+	case 2:
+		target = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		target = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		target = uint(binary.BigEndian.Uint32(b))
+	}
+	return target, off + n, nil
+}
+
+func stringOf(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func uintOf(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,180 @@
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// ctrl encodes an MMDB control byte and size for typ.
+func ctrl(typ, size int) []byte {
+	var out []byte
+	var extra []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		extra = []byte{byte(size - 29)}
+		size = 29
+	case size < 65821:
+		s := size - 285
+		extra = []byte{byte(s >> 8), byte(s)}
+		size = 30
+	default:
+		s := size - 65821
+		extra = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+		size = 31
+	}
+	if typ > 7 {
+		out = []byte{byte(size), byte(typ - 7)}
+	} else {
+		out = []byte{byte(typ<<5 | size)}
+	}
+	return append(out, extra...)
+}
+
+func encString(s string) []byte {
+	return append(ctrl(typeString, len(s)), s...)
+}
+
+func encUint(typ int, v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return append(ctrl(typ, len(b)), b...)
+}
+
+func encMap(m map[string][]byte) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := ctrl(typeMap, len(m))
+	for _, k := range keys {
+		out = append(out, encString(k)...)
+		out = append(out, m[k]...)
+	}
+	return out
+}
+
+func encArray(items ...[]byte) []byte {
+	out := ctrl(typeArray, len(items))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// buildIPv4 builds a 24-bit record IPv4 database in which prefix (a /24)
+// maps to record and every other address has no entry.
+func buildIPv4(prefix netip.Prefix, record []byte) []byte {
+	const nodes = 24
+	a := prefix.Addr().As4()
+	var tree []byte
+	for i := 0; i < nodes; i++ {
+		next := uint(i + 1)
+		if i == nodes-1 {
+			next = nodes + dataSeparator
+		}
+		rec := [2]uint{nodes, nodes}
+		rec[a[i/8]>>(7-i%8)&1] = next
+		for _, r := range rec {
+			tree = append(tree, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	buf := append(tree, make([]byte, dataSeparator)...)
+	buf = append(buf, record...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, encMap(map[string][]byte{
+		"database_type": encString("Test-City"),
+		"ip_version":    encUint(typeUint16, 4),
+		"record_size":   encUint(typeUint16, 24),
+		"node_count":    encUint(typeUint32, nodes),
+		"build_epoch":   encUint(typeUint64, 1700000000),
+	})...)
+}
+
+func TestDatabaseLookup(t *testing.T) {
+	// Sizes from 285 on take two extra size bytes.
+	long := strings.Repeat("x", 300)
+	items := make([][]byte, 290)
+	for i := range items {
+		items[i] = encUint(typeUint16, uint64(i))
+	}
+	record := encMap(map[string][]byte{
+		"country": encMap(map[string][]byte{
+			"iso_code": encString("DE"),
+			"names":    encMap(map[string][]byte{"en": encString("Germany")}),
+		}),
+		"note": encString(long),
+		"list": encArray(items...),
+	})
+
+	db, err := parseDatabase(buildIPv4(netip.MustParsePrefix("192.0.2.0/24"), record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.DatabaseType != "Test-City" || db.NodeCount != 24 || db.BuildEpoch != 1700000000 {
+		t.Fatalf("metadata %+v", db.Metadata)
+	}
+
+	m, err := db.Lookup(netip.MustParseAddr("192.0.2.77"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	country, _ := m["country"].(map[string]interface{})
+	if got := stringOf(country["iso_code"]); got != "DE" {
+		t.Fatalf("iso_code %q", got)
+	}
+	if got := stringOf(m["note"]); got != long {
+		t.Fatalf("note has %d bytes, want %d", len(got), len(long))
+	}
+	list, _ := m["list"].([]interface{})
+	if len(list) != len(items) || uintOf(list[289]) != 289 {
+		t.Fatalf("list has %d items", len(list))
+	}
+
+	for _, addr := range []string{"192.0.3.1", "10.0.0.1", "2001:db8::1"} {
+		if m, err := db.Lookup(netip.MustParseAddr(addr)); m != nil || err != nil {
+			t.Fatalf("%s: got %v, %v", addr, m, err)
+		}
+	}
+}
+
+func TestDecodeSizes(t *testing.T) {
+	for _, n := range []int{0, 28, 29, 284, 285, 288, 300, 65820, 65821, 70000} {
+		s := strings.Repeat("a", n)
+		v, next, err := decoder{buf: encString(s)}.decode(0, 0)
+		if err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+		if got := stringOf(v); len(got) != n || int(next) != len(encString(s)) {
+			t.Fatalf("%d: decoded %d bytes, next %d", n, len(got), next)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated string": encString("hello")[:3],
+		"truncated size":   {typeString<<5 | 30, 0},
+		"map key not string": append(ctrl(typeMap, 1),
+			append(encUint(typeUint16, 1), encString("v")...)...),
+		"pointer loop": {typePointer << 5, 0},
+		"double size":  append(ctrl(typeDouble, 4), 0, 0, 0, 0),
+	}
+	for name, buf := range tests {
+		if _, _, err := (decoder{buf: buf}).decode(0, 0); !errors.Is(err, ErrInvalidDatabase) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	if _, err := parseDatabase(bytes.Repeat([]byte{0}, 64)); !errors.Is(err, ErrInvalidDatabase) {
+		t.Errorf("no metadata: got %v", err)
+	}
+}
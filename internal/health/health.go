@@ -0,0 +1,238 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ReaderStats struct {
+	Received       uint64            `json:"received"`
+	Lost           uint64            `json:"lost"`
+	DecodeFailures uint64            `json:"decode_failures"`
+	DecodeErrors   map[string]uint64 `json:"decode_errors,omitempty"`
+	ReadErrors     uint64            `json:"read_errors"`
+	LastEvent      time.Time         `json:"last_event,omitempty"`
+	LastPoll       time.Time         `json:"last_poll,omitempty"`
+}
+
+type ProbeStats struct {
+	Events    uint64    `json:"events"`
+	LastEvent time.Time `json:"last_event,omitempty"`
+	SinceLast string    `json:"since_last,omitempty"`
+}
+
+type Report struct {
+	Status  string                 `json:"status"`
+	Reason  string                 `json:"reason,omitempty"`
+	Started time.Time              `json:"started"`
+	Uptime  string                 `json:"uptime"`
+	Readers map[string]ReaderStats `json:"readers"`
+	Probes  map[string]ProbeStats  `json:"probes"`
+	Extra   map[string]interface{} `json:"extra,omitempty"`
+}
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+type Transition struct {
+	Degraded bool
+	Reason   string
+}
+
+type Tracker struct {
+	mu          sync.Mutex
+	started     time.Time
+	readers     map[string]*ReaderStats
+	probes      map[string]*ProbeStats
+	lostAtCheck map[string]uint64
+	degraded    bool
+	reason      string
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		started:     time.Now(),
+		readers:     make(map[string]*ReaderStats),
+		probes:      make(map[string]*ProbeStats),
+		lostAtCheck: make(map[string]uint64),
+	}
+}
+
+func (t *Tracker) reader(name string) *ReaderStats {
+	r, ok := t.readers[name]
+	if !ok {
+		r = &ReaderStats{}
+		t.readers[name] = r
+	}
+	return r
+}
+
+func (t *Tracker) Received(reader string) {
+	t.mu.Lock()
+	r := t.reader(reader)
+	r.Received++
+	r.LastEvent = time.Now()
+	t.mu.Unlock()
+}
+
+// Heartbeat records that the reader goroutine returned from a poll, with
+// or without a record.
+func (t *Tracker) Heartbeat(reader string) {
+	t.mu.Lock()
+	t.reader(reader).LastPoll = time.Now()
+	t.mu.Unlock()
+}
+
+// Stalled lists the readers that have polled before but not within maxAge.
+func (t *Tracker) Stalled(maxAge time.Duration) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var stalled []string
+	now := time.Now()
+	for name, r := range t.readers {
+		if !r.LastPoll.IsZero() && now.Sub(r.LastPoll) > maxAge {
+			stalled = append(stalled, name)
+		}
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+func (t *Tracker) Lost(reader string, n uint64) {
+	t.mu.Lock()
+	t.reader(reader).Lost += n
+	t.mu.Unlock()
+}
+
+func (t *Tracker) DecodeFailure(reader string, reason string) {
+	t.mu.Lock()
+	r := t.reader(reader)
+	r.DecodeFailures++
+	if r.DecodeErrors == nil {
+		r.DecodeErrors = make(map[string]uint64)
+	}
+	r.DecodeErrors[reason]++
+	t.mu.Unlock()
+}
+
+func (t *Tracker) ReadError(reader string) {
+	t.mu.Lock()
+	t.reader(reader).ReadErrors++
+	t.mu.Unlock()
+}
+
+func (t *Tracker) ProbeFired(probe string) {
+	t.mu.Lock()
+	p, ok := t.probes[probe]
+	if !ok {
+		p = &ProbeStats{}
+		t.probes[probe] = p
+	}
+	p.Events++
+	p.LastEvent = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *Tracker) RegisterProbe(probe string) {
+	t.mu.Lock()
+	if _, ok := t.probes[probe]; !ok {
+		t.probes[probe] = &ProbeStats{}
+	}
+	t.mu.Unlock()
+}
+
+// UnregisterProbe forgets a probe whose feature was unloaded.
+func (t *Tracker) UnregisterProbe(probe string) {
+	t.mu.Lock()
+	delete(t.probes, probe)
+	t.mu.Unlock()
+}
+
+// Check compares the samples lost since the previous call against
+// threshold and returns a transition when the degraded state changes.
+func (t *Tracker) Check(threshold uint64) *Transition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var worst string
+	var worstLost uint64
+	names := make([]string, 0, len(t.readers))
+	for name := range t.readers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r := t.readers[name]
+		lost := r.Lost - t.lostAtCheck[name]
+		t.lostAtCheck[name] = r.Lost
+		if lost > worstLost {
+			worst, worstLost = name, lost
+		}
+	}
+
+	degraded := threshold > 0 && worstLost >= threshold
+	if degraded == t.degraded {
+		return nil
+	}
+
+	t.degraded = degraded
+	t.reason = ""
+	if degraded {
+		t.reason = fmt.Sprintf("%s reader lost %d samples since the last check", worst, worstLost)
+	}
+	return &Transition{Degraded: degraded, Reason: t.reason}
+}
+
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	rep := Report{
+		Status:  StatusOK,
+		Reason:  t.reason,
+		Started: t.started,
+		Uptime:  now.Sub(t.started).Round(time.Second).String(),
+		Readers: make(map[string]ReaderStats, len(t.readers)),
+		Probes:  make(map[string]ProbeStats, len(t.probes)),
+	}
+	if t.degraded {
+		rep.Status = StatusDegraded
+	}
+	for name, r := range t.readers {
+		rs := *r
+		rs.DecodeErrors = make(map[string]uint64, len(r.DecodeErrors))
+		for reason, n := range r.DecodeErrors {
+			rs.DecodeErrors[reason] = n
+		}
+		rep.Readers[name] = rs
+	}
+	for name, p := range t.probes {
+		ps := *p
+		if !ps.LastEvent.IsZero() {
+			ps.SinceLast = now.Sub(ps.LastEvent).Round(time.Second).String()
+		}
+		rep.Probes[name] = ps
+	}
+	return rep
+}
+
+func Handler(report func() Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := report()
+		w.Header().Set("Content-Type", "application/json")
+		if rep.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	})
+}
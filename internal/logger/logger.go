@@ -5,16 +5,49 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
 
+type Field struct {
+	Key   string
+	Value string
+}
+
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: fmt.Sprint(value)}
+}
+
+
+func FormatFields(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		if f.Value == "" {
+			continue
+		}
+		b.WriteString(" ")
+		b.WriteString(f.Key)
+		b.WriteString("=")
+		if strings.ContainsFunc(f.Value, func(r rune) bool { return r <= ' ' || r == '"' || r == 0x7f }) {
+			fmt.Fprintf(&b, "%q", f.Value)
+		} else {
+			b.WriteString(f.Value)
+		}
+	}
+	return b.String()
+}
+
+
 type Logger struct {
 	consoleLog *log.Logger
 	fileLog    *log.Logger
 	logFile    *os.File
 	logDir     string
 	attempts   map[string]int
+	mu         sync.Mutex
 }
 
 
@@ -64,26 +97,38 @@ func (l *Logger) StartMonitoring() {
 }
 
 
-func (l *Logger) LogSSHDetected(ip string, port int, pid uint32, comm string) {
+func (l *Logger) LogSSHDetected(ip string, port int, pid uint32, comm string, fields ...Field) {
+	l.LogServiceDetected("ssh", ip, port, pid, comm, fields...)
+}
+
+
+func (l *Logger) LogServiceDetected(service string, ip string, port int, pid uint32, comm string, fields ...Field) {
 
-	l.attempts[ip]++
-	attemptCount := l.attempts[ip]
+	l.mu.Lock()
+	l.attempts[service+"/"+ip]++
+	attemptCount := l.attempts[service+"/"+ip]
+	l.mu.Unlock()
 
 
 	detectionTime := time.Now().Format("2006-01-02 15:04:05")
-	message := fmt.Sprintf("ssh detected : %s:%d, attempt %d, time %s (pid=%d, comm=%s)",
-		ip, port, attemptCount, detectionTime, pid, comm)
+	message := fmt.Sprintf("%s detected : %s:%d, attempt %d, time %s (pid=%d, comm=%s)%s",
+		service, ip, port, attemptCount, detectionTime, pid, comm, FormatFields(fields))
 
-	l.log(message)
+	l.log("%s", message)
 }
 
 
-func (l *Logger) LogEvent(ip string, port int, pid uint32, comm string) {
+func (l *Logger) LogEvent(ip string, port int, pid uint32, comm string, fields ...Field) {
 	detectionTime := time.Now().Format("2006-01-02 15:04:05")
-	message := fmt.Sprintf("accept event: %s:%d (pid=%d, comm=%s, time=%s)",
-		ip, port, pid, comm, detectionTime)
+	message := fmt.Sprintf("accept event: %s:%d (pid=%d, comm=%s, time=%s)%s",
+		ip, port, pid, comm, detectionTime, FormatFields(fields))
 
-	l.log(message)
+	l.log("%s", message)
+}
+
+
+func (l *Logger) LogAlert(alertType string, severity string, message string, fields ...Field) {
+	l.log("ALERT[%s/%s]: %s%s", alertType, severity, message, FormatFields(fields))
 }
 
 
@@ -96,3 +141,8 @@ func (l *Logger) LogInfo(format string, args ...interface{}) {
 	l.log("INFO: "+format, args...)
 }
 
+
+func (l *Logger) LogInfoFields(fields []Field, format string, args ...interface{}) {
+	l.log("INFO: %s%s", fmt.Sprintf(format, args...), FormatFields(fields))
+}
+
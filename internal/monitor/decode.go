@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	EventMagic   uint32 = 0x53435244
+	EventVersion uint16 = 1
+)
+
+const (
+	EventTypeAccept uint16 = iota + 1
+	EventTypeAuth
+	EventTypeExec
+	EventTypeConnect
+)
+
+// EventHeader mirrors struct event_header in bpf/secrds_event.h and
+// prefixes every perf record.
+type EventHeader struct {
+	Magic   uint32
+	Version uint16
+	Type    uint16
+	Length  uint32
+	_       uint32
+}
+
+var headerSize = binary.Size(EventHeader{})
+
+var (
+	ErrShortRecord = errors.New("short record")
+	ErrBadMagic    = errors.New("bad magic")
+	ErrBadVersion  = errors.New("unsupported version")
+	ErrBadType     = errors.New("unexpected event type")
+	ErrBadLength   = errors.New("length mismatch")
+	ErrBadField    = errors.New("invalid field value")
+)
+
+type DecodeError struct {
+	Reason error
+	Detail string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Reason, e.Detail)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Reason
+}
+
+// decodeReason is the short label health accounting uses for err.
+func decodeReason(err error) string {
+	for _, reason := range []error{ErrShortRecord, ErrBadMagic, ErrBadVersion, ErrBadType, ErrBadLength, ErrBadField} {
+		if errors.Is(err, reason) {
+			return reason.Error()
+		}
+	}
+	return "other"
+}
+
+func decodeRecord(raw []byte, eventType uint16, out interface{}) error {
+	if len(raw) < headerSize {
+		return &DecodeError{ErrShortRecord, fmt.Sprintf("%d bytes, header needs %d", len(raw), headerSize)}
+	}
+
+	var hdr EventHeader
+	if err := binary.Read(bytes.NewReader(raw[:headerSize]), binary.NativeEndian, &hdr); err != nil {
+		return &DecodeError{ErrShortRecord, err.Error()}
+	}
+	if hdr.Magic != EventMagic {
+		return &DecodeError{ErrBadMagic, fmt.Sprintf("%#x", hdr.Magic)}
+	}
+	if hdr.Version != EventVersion {
+		return &DecodeError{ErrBadVersion, fmt.Sprintf("got %d, want %d", hdr.Version, EventVersion)}
+	}
+	if hdr.Type != eventType {
+		return &DecodeError{ErrBadType, fmt.Sprintf("got %d, want %d", hdr.Type, eventType)}
+	}
+
+	size := binary.Size(out)
+	// perf pads raw samples up to 8 bytes, so allow trailing slack but
+	// nothing more.
+	if int(hdr.Length) != size || len(raw) < size || len(raw)-size >= 8 {
+		return &DecodeError{ErrBadLength, fmt.Sprintf("header %d, record %d, struct %d", hdr.Length, len(raw), size)}
+	}
+
+	return binary.Read(bytes.NewReader(raw[:size]), binary.NativeEndian, out)
+}
+
+func DecodeAcceptEvent(raw []byte) (*AcceptEvent, error) {
+	var ev AcceptEvent
+	if err := decodeRecord(raw, EventTypeAccept, &ev); err != nil {
+		return nil, err
+	}
+
+	// Addresses and ports are stored in network byte order by the probe.
+	ev.PeerIP = networkToHost32(ev.PeerIP)
+	ev.PeerPort = networkToHost16(ev.PeerPort)
+	ev.LocalIP = networkToHost32(ev.LocalIP)
+	ev.LocalPort = networkToHost16(ev.LocalPort)
+	if ev.HasSockInfo > 1 {
+		return nil, &DecodeError{ErrBadField, fmt.Sprintf("has_sock_info %d", ev.HasSockInfo)}
+	}
+	return &ev, nil
+}
+
+func DecodeAuthEvent(raw []byte) (*AuthEvent, error) {
+	var ev AuthEvent
+	if err := decodeRecord(raw, EventTypeAuth, &ev); err != nil {
+		return nil, err
+	}
+	if ev.Kind > AuthKindCloseSession {
+		return nil, &DecodeError{ErrBadType, fmt.Sprintf("auth kind %d", ev.Kind)}
+	}
+	return &ev, nil
+}
+
+func DecodeExecEvent(raw []byte) (*ExecEvent, error) {
+	var ev ExecEvent
+	if err := decodeRecord(raw, EventTypeExec, &ev); err != nil {
+		return nil, err
+	}
+	if ev.Kind > ExecKindExit {
+		return nil, &DecodeError{ErrBadType, fmt.Sprintf("exec kind %d", ev.Kind)}
+	}
+	if int(ev.Argc) > len(ev.Argv) {
+		return nil, &DecodeError{ErrBadField, fmt.Sprintf("argc %d", ev.Argc)}
+	}
+	return &ev, nil
+}
+
+func DecodeConnectEvent(raw []byte) (*ConnectEvent, error) {
+	var ev ConnectEvent
+	if err := decodeRecord(raw, EventTypeConnect, &ev); err != nil {
+		return nil, err
+	}
+	if ev.Kind > ConnectKindListen {
+		return nil, &DecodeError{ErrBadType, fmt.Sprintf("connect kind %d", ev.Kind)}
+	}
+	if ev.Family != afInet && ev.Family != afInet6 {
+		return nil, &DecodeError{ErrBadField, fmt.Sprintf("address family %d", ev.Family)}
+	}
+	return &ev, nil
+}
+
+func swap32(v uint32) uint32 {
+	return v>>24 | (v>>8)&0xff00 | (v<<8)&0xff0000 | v<<24
+}
+
+func swap16(v uint16) uint16 {
+	return v>>8 | v<<8
+}
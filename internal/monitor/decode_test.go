@@ -0,0 +1,199 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func header(eventType uint16, size int) EventHeader {
+	return EventHeader{Magic: EventMagic, Version: EventVersion, Type: eventType, Length: uint32(size)}
+}
+
+func encode(t testing.TB, ev interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.NativeEndian, ev); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func acceptRecord(t testing.TB) []byte {
+	ev := AcceptEvent{Pid: 10, Tgid: 10, PeerPort: 0x1600, HasSockInfo: 1}
+	ev.Header = header(EventTypeAccept, binary.Size(ev))
+	return encode(t, &ev)
+}
+
+func authRecord(t testing.TB) []byte {
+	ev := AuthEvent{Pid: 11, Tgid: 11, Kind: AuthKindOpenSession}
+	ev.Header = header(EventTypeAuth, binary.Size(ev))
+	return encode(t, &ev)
+}
+
+func execRecord(t testing.TB) []byte {
+	ev := ExecEvent{Pid: 12, Tgid: 12, Kind: ExecKindExec, Argc: 2}
+	ev.Header = header(EventTypeExec, binary.Size(ev))
+	return encode(t, &ev)
+}
+
+func connectRecord(t testing.TB) []byte {
+	ev := ConnectEvent{Pid: 13, Tgid: 13, Family: afInet, Kind: ConnectKindConnect}
+	ev.Header = header(EventTypeConnect, binary.Size(ev))
+	return encode(t, &ev)
+}
+
+// patch returns a copy of raw with b written at off.
+func patch(raw []byte, off int, b ...byte) []byte {
+	out := append([]byte(nil), raw...)
+	copy(out[off:], b)
+	return out
+}
+
+func u32(v uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, v)
+}
+
+func u16(v uint16) []byte {
+	return binary.NativeEndian.AppendUint16(nil, v)
+}
+
+func TestDecodeRecord(t *testing.T) {
+	accept := acceptRecord(t)
+	size := len(accept)
+	hasSockInfo := binary.Size(EventHeader{}) + 4 + 4 + 4 + 4 + 8 + 16 + 4 + 2 + 2 + 4 + 2
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want error
+	}{
+		{"valid", accept, nil},
+		{"perf padding", append(append([]byte(nil), accept...), 0, 0, 0, 0), nil},
+		{"empty", nil, ErrShortRecord},
+		{"short header", accept[:headerSize-1], ErrShortRecord},
+		{"bad magic", patch(accept, 0, u32(0xdeadbeef)...), ErrBadMagic},
+		{"bad version", patch(accept, 4, u16(EventVersion+1)...), ErrBadVersion},
+		{"bad type", patch(accept, 6, u16(EventTypeAuth)...), ErrBadType},
+		{"header length too small", patch(accept, 8, u32(uint32(size-8))...), ErrBadLength},
+		{"header length too large", patch(accept, 8, u32(uint32(size+8))...), ErrBadLength},
+		{"truncated body", accept[:size-8], ErrBadLength},
+		{"too much trailing data", append(append([]byte(nil), accept...), make([]byte, 8)...), ErrBadLength},
+		{"bad has_sock_info", patch(accept, hasSockInfo, 2), ErrBadField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := DecodeAcceptEvent(tt.raw)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if ev.Tgid != 10 || ev.PeerPort != 0x16 || ev.HasSockInfo != 1 {
+					t.Fatalf("decoded %+v", ev)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if got := decodeReason(err); got != tt.want.Error() {
+				t.Fatalf("reason %q, want %q", got, tt.want.Error())
+			}
+		})
+	}
+}
+
+func TestDecodeKinds(t *testing.T) {
+	auth := authRecord(t)
+	if _, err := DecodeAuthEvent(auth); err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	if _, err := DecodeAuthEvent(patch(auth, len(auth)-68, AuthKindCloseSession+1)); !errors.Is(err, ErrBadType) {
+		t.Fatalf("auth kind: got %v", err)
+	}
+
+	exec := execRecord(t)
+	if _, err := DecodeExecEvent(exec); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	argc := headerSize + 4*4 + 8 + 8 + 16 + 1
+	if _, err := DecodeExecEvent(patch(exec, argc, 9)); !errors.Is(err, ErrBadField) {
+		t.Fatalf("exec argc: got %v", err)
+	}
+
+	connect := connectRecord(t)
+	if _, err := DecodeConnectEvent(connect); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	family := headerSize + 4*4 + 8 + 8 + 16
+	if _, err := DecodeConnectEvent(patch(connect, family, u16(1)...)); !errors.Is(err, ErrBadField) {
+		t.Fatalf("connect family: got %v", err)
+	}
+	if _, err := DecodeConnectEvent(connect[:len(connect)-8]); !errors.Is(err, ErrBadLength) {
+		t.Fatalf("connect length: got %v", err)
+	}
+}
+
+// checkDecodeError fails unless err is nil or a classified DecodeError.
+func checkDecodeError(t *testing.T, err error) {
+	var de *DecodeError
+	if err != nil && (!errors.As(err, &de) || decodeReason(err) == "other") {
+		t.Fatalf("unclassified error %v", err)
+	}
+}
+
+func FuzzDecodeAcceptEvent(f *testing.F) {
+	f.Add(acceptRecord(f))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		ev, err := DecodeAcceptEvent(raw)
+		checkDecodeError(t, err)
+		if err == nil && ev.HasSockInfo > 1 {
+			t.Fatalf("accepted has_sock_info %d", ev.HasSockInfo)
+		}
+	})
+}
+
+func FuzzDecodeAuthEvent(f *testing.F) {
+	f.Add(authRecord(f))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		ev, err := DecodeAuthEvent(raw)
+		checkDecodeError(t, err)
+		if err == nil {
+			if ev.Kind > AuthKindCloseSession {
+				t.Fatalf("accepted kind %d", ev.Kind)
+			}
+			ev.PAMService()
+			ev.RemoteIP()
+		}
+	})
+}
+
+func FuzzDecodeExecEvent(f *testing.F) {
+	f.Add(execRecord(f))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		ev, err := DecodeExecEvent(raw)
+		checkDecodeError(t, err)
+		if err == nil {
+			if ev.Kind > ExecKindExit {
+				t.Fatalf("accepted kind %d", ev.Kind)
+			}
+			ev.Args()
+		}
+	})
+}
+
+func FuzzDecodeConnectEvent(f *testing.F) {
+	f.Add(connectRecord(f))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		ev, err := DecodeConnectEvent(raw)
+		checkDecodeError(t, err)
+		if err == nil && ev.Family != afInet && ev.Family != afInet6 {
+			t.Fatalf("accepted family %d", ev.Family)
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"golang.org/x/sys/unix"
+
+	"secrds/internal/logger"
+	"secrds/internal/procfs"
+)
+
+type ExecEvent struct {
+	Header      EventHeader
+	Pid         uint32
+	Tgid        uint32
+	Uid         uint32
+	SessionRoot uint32
+	TsNs        uint64
+	CgroupID    uint64
+	Comm        [16]byte
+	Kind        uint8
+	Argc        uint8
+	Filename    [128]byte
+	Argv        [8][64]byte
+	_           [6]byte
+}
+
+const (
+	ExecKindExec uint8 = iota
+	ExecKindExit
+)
+
+func (ev *ExecEvent) Args() []string {
+	args := make([]string, 0, ev.Argc)
+	for i := 0; i < int(ev.Argc) && i < len(ev.Argv); i++ {
+		args = append(args, strings.TrimRight(string(ev.Argv[i][:]), "\x00"))
+	}
+	return args
+}
+
+// execTracepoints are the tracepoints the exec collection attaches to,
+// including the connect feature's inet_sock_set_state.
+var execTracepoints = []struct {
+	group, name, prog string
+}{
+	{"sched", "sched_process_fork", "trace_sched_process_fork"},
+	{"syscalls", "sys_enter_execve", "trace_enter_execve"},
+	{"sched", "sched_process_exec", "trace_sched_process_exec"},
+	{"sched", "sched_process_exit", "trace_sched_process_exit"},
+	{"sock", "inet_sock_set_state", "trace_inet_sock_set_state"},
+}
+
+func (m *Monitor) LoadExecBPF(bpfObjFile string) error {
+	coll, err := loadCollection(bpfObjFile)
+	if err != nil {
+		return fmt.Errorf("failed to load exec BPF collection: %w", err)
+	}
+
+	m.execCollection = coll
+	m.execLinks = len(m.links)
+	return nil
+}
+
+func (m *Monitor) AttachExec() error {
+	if m.execCollection == nil {
+		return fmt.Errorf("exec BPF collection not loaded")
+	}
+
+	for _, tp := range execTracepoints {
+		prog := m.execCollection.Programs[tp.prog]
+		if prog == nil {
+			return fmt.Errorf("%s program not found in exec BPF collection", tp.prog)
+		}
+		l, err := link.Tracepoint(tp.group, tp.name, prog, nil)
+		if err != nil {
+			return fmt.Errorf("failed to attach tracepoint %s/%s: %w", tp.group, tp.name, err)
+		}
+		m.links = append(m.links, l)
+		m.health.RegisterProbe(tp.name)
+		m.logger.LogInfo("Successfully attached to tracepoint: %s", tp.name)
+	}
+
+	return nil
+}
+
+func (m *Monitor) StartExecPerfReader() error {
+	if m.execCollection == nil {
+		return fmt.Errorf("exec BPF collection not loaded")
+	}
+
+	eventsMap := m.execCollection.Maps["exec_events"]
+	if eventsMap == nil {
+		return fmt.Errorf("failed to find exec_events map")
+	}
+
+	rd, err := perf.NewReader(eventsMap, 16*os.Getpagesize())
+	if err != nil {
+		return fmt.Errorf("failed to create exec perf reader: %w", err)
+	}
+
+	m.execReader = rd
+	return nil
+}
+
+func (m *Monitor) ProcessExecEvents() {
+	m.consume(m.execReader, "exec", func(raw []byte) (uint32, func(), error) {
+		ev, err := DecodeExecEvent(raw)
+		if err != nil {
+			return 0, nil, err
+		}
+		m.execProbesFired(ev)
+		pc := m.snapshotProc(ev)
+		return ev.SessionRoot, func() { m.handleExecEvent(ev, pc) }, nil
+	})
+}
+
+// procContext is what /proc says about the process behind an exec event.
+type procContext struct {
+	cwd   string
+	ppid  uint32 // 0 when unknown
+	netns uint64
+}
+
+// snapshotProc reads the process's /proc entries as soon as its event is
+// decoded, since a short-lived command is often gone before a worker runs.
+func (m *Monitor) snapshotProc(ev *ExecEvent) procContext {
+	pc := procContext{netns: m.netnsOf(ev.Tgid)}
+	if ev.Kind != ExecKindExec {
+		return pc
+	}
+	if st, err := readProcStat(m.proc, ev.Tgid); err == nil {
+		pc.ppid = st.PPid
+	}
+	if cwd, err := m.proc.Readlink(procfs.PidPath(ev.Tgid, "cwd")); err == nil {
+		pc.cwd = cwd
+	}
+	return pc
+}
+
+// execProbesFired counts the probes behind an exec event. Exec events are
+// built by sys_enter_execve and sent by sched_process_exec, and an event
+// from any process other than the session root means sched_process_fork
+// added it to the session.
+func (m *Monitor) execProbesFired(ev *ExecEvent) {
+	if ev.Kind == ExecKindExit {
+		m.health.ProbeFired("sched_process_exit")
+	} else {
+		m.health.ProbeFired("sys_enter_execve")
+		m.health.ProbeFired("sched_process_exec")
+	}
+	if ev.Tgid != ev.SessionRoot {
+		m.health.ProbeFired("sched_process_fork")
+	}
+}
+
+func (m *Monitor) trackSession(root uint32) {
+	if m.execCollection == nil {
+		return
+	}
+	procs := m.execCollection.Maps["session_procs"]
+	if procs == nil {
+		return
+	}
+	if err := procs.Update(root, root, ebpf.UpdateAny); err != nil {
+		m.logger.LogError("Failed to track session process %d: %v", root, err)
+	}
+}
+
+func (m *Monitor) untrackSession(root uint32) {
+	if m.execCollection == nil {
+		return
+	}
+	if procs := m.execCollection.Maps["session_procs"]; procs != nil {
+		procs.Delete(root)
+	}
+}
+
+func (m *Monitor) handleExecEvent(ev *ExecEvent, pc procContext) {
+	fields := []logger.Field{
+		logger.F("session_root", ev.SessionRoot),
+		logger.F("pid", ev.Tgid),
+		logger.F("uid", ev.Uid),
+		logger.F("time", monotonicToWall(ev.TsNs).Format(time.RFC3339Nano)),
+	}
+	if s := m.sessions.get(ev.SessionRoot); s != nil {
+		fields = append([]logger.Field{logger.F("session", s.ID), logger.F("user", s.User), logger.F("rhost", s.RemoteHost)}, fields...)
+	}
+	fields = append(fields, m.eventFields(ev.CgroupID, ev.Tgid, pc.netns)...)
+
+	switch ev.Kind {
+	case ExecKindExec:
+		fields = append(fields, logger.F("filename", strings.TrimRight(string(ev.Filename[:]), "\x00")))
+		if pc.ppid != 0 {
+			fields = append(fields, logger.F("ppid", pc.ppid))
+		}
+		if pc.cwd != "" {
+			fields = append(fields, logger.F("cwd", pc.cwd))
+		}
+		fields = append(fields, logger.F("argv", strings.Join(ev.Args(), " ")))
+		m.logger.LogInfoFields(fields, "Session command")
+
+	case ExecKindExit:
+		fields = append(fields, logger.F("comm", strings.TrimRight(string(ev.Comm[:]), "\x00")))
+		m.logger.LogInfoFields(fields, "Session process exited")
+	}
+}
+
+func monotonicToWall(tsNs uint64) time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Now()
+	}
+	return time.Now().Add(-time.Duration(uint64(ts.Nano()) - tsNs))
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"fmt"
+	"net/netip"
+
+	"secrds/internal/alert"
+	"secrds/internal/config"
+	"secrds/internal/geoip"
+	"secrds/internal/logger"
+)
+
+// geoFence evaluates the geo-fencing policies selected by covers for a
+// connection or login from addr. It reports whether a policy banned addr,
+// in which case the caller cuts the connection.
+func (m *Monitor) geoFence(stage string, covers func(*config.GeoFence) bool, addr netip.Addr, info geoip.Info, fields []logger.Field) bool {
+	cfg := m.config()
+	if len(cfg.GeoFences) == 0 || !m.geo.Enabled() {
+		// Without GeoIP data every address would look unknown.
+		return false
+	}
+	banned := false
+	for i := range cfg.GeoFences {
+		g := &cfg.GeoFences[i]
+		if !covers(g) {
+			continue
+		}
+		reason := g.Violation(addr, info.CountryCode, info.ASN)
+		if reason == "" {
+			continue
+		}
+
+		m.alerts.Raise(alert.Alert{
+			Type:     "geofence_violation",
+			Severity: alert.SeverityWarning,
+			Message:  fmt.Sprintf("%s from %s violates geofence %q: %s", stage, addr, g.Name, reason),
+			Fields: append([]logger.Field{
+				logger.F("policy", g.Name),
+				logger.F("ip", addr),
+				logger.F("stage", stage),
+				logger.F("action", g.Action),
+			}, fields...),
+		})
+		if g.Action == config.ActionBan && m.response != nil {
+			m.response.Ban(addr, "geofence "+g.Name, reason, g.BanDuration.Duration, fields...)
+			banned = true
+		}
+	}
+	return banned
+}
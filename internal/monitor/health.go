@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/health"
+	"secrds/internal/logger"
+)
+
+func (m *Monitor) HealthReport() health.Report {
+	rep := m.health.Report()
+	stats := m.pool.Stats()
+	rep.Extra = map[string]interface{}{
+		"queue_depth":    stats.Depth,
+		"queue_capacity": stats.Capacity,
+		"pipeline":       stats.Stages,
+	}
+	return rep
+}
+
+// WatchHealth checks sample loss every health.check_interval. The interval
+// is read again after each check, so a reload can change, disable or
+// enable it.
+func (m *Monitor) WatchHealth() {
+	m.every(func() time.Duration { return m.config().Health.CheckInterval.Duration }, m.checkHealth)
+}
+
+func (m *Monitor) checkHealth() {
+	cfg := m.config().Health
+	t := m.health.Check(cfg.LossThreshold)
+	if t == nil {
+		return
+	}
+
+	if t.Degraded {
+		m.alerts.Raise(alert.Alert{
+			Type:     "monitor_degraded",
+			Severity: alert.SeverityCritical,
+			Message:  t.Reason,
+			Fields:   []logger.Field{logger.F("threshold", cfg.LossThreshold)},
+		})
+	} else {
+		m.alerts.Raise(alert.Alert{
+			Type:     "monitor_recovered",
+			Severity: alert.SeverityInfo,
+			Message:  "sample loss is back below the threshold",
+		})
+	}
+}
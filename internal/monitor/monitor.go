@@ -2,52 +2,92 @@ package monitor
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/cilium/ebpf/perf"
 	"github.com/cilium/ebpf/rlimit"
 
+	"secrds/internal/alert"
+	"secrds/internal/config"
+	"secrds/internal/container"
+	"secrds/internal/geoip"
+	"secrds/internal/health"
 	"secrds/internal/logger"
+	"secrds/internal/pamlib"
+	"secrds/internal/pipeline"
+	"secrds/internal/procfs"
+	"secrds/internal/rdns"
+	"secrds/internal/response"
+	"secrds/internal/risk"
+	"secrds/internal/sockdiag"
+	"secrds/internal/threatintel"
+	"secrds/internal/window"
 )
 
 type AcceptEvent struct {
+	Header     EventHeader
 	Pid        uint32
 	Tgid       uint32
 	Fd         int32
+	_          [4]byte
 	TsNs       uint64
 	Comm       [16]byte
 	PeerIP     uint32   
 	PeerPort   uint16 
+	_          [2]byte
 	LocalIP    uint32   	
 	LocalPort  uint16   
 	HasSockInfo uint8 
-	_          [3]byte 
+	_          [1]byte 
+	CgroupID   uint64
+	Netns      uint32
+	_          [4]byte
 }
 
 type AuthEvent struct {
+	Header    EventHeader
 	Pid       uint32
 	Tgid      uint32
 	RetCode   int32   
+	_         [4]byte
 	TsNs      uint64
 	Comm      [16]byte
 	IsFailure uint8  
-	_         [3]byte  
+	_         [7]byte  
+	CgroupID  uint64
+	Service   [32]byte
+	Uid       uint32
+	User      [32]byte
+	TTY       [32]byte
+	Kind      uint8
+	RHost     [64]byte
+	_         [3]byte
 }
 
+const (
+	AuthKindAuthenticate uint8 = iota
+	AuthKindAcctMgmt
+	AuthKindOpenSession
+	AuthKindCloseSession
+)
+
 
 type Monitor struct {
 	logger        *logger.Logger
@@ -62,17 +102,56 @@ type Monitor struct {
 	shuttingDown  int32             
 	failureCounts map[string]int    
 	failureMutex  sync.RWMutex      
+	containers    *container.Resolver
+	cfg           atomic.Pointer[config.Config]
+	alerts        *alert.Dispatcher
+	serviceCounters map[string]*window.Counter
+	serviceMutex  sync.Mutex
+	privEscCounter *window.Counter
+	sessions      *sessionTable
+	execCollection *ebpf.Collection
+	execReader    *perf.Reader
+	connectReader *perf.Reader
+	sockets       *sockdiag.Resolver
+	pool          *pipeline.Pool
+	health        *health.Tracker
+	proc          procfs.FS
+	pamLibraries  []pamlib.Library
+	geo           *geoip.Enricher
+	response      *response.Responder
+	intel         *threatintel.Feeds
+	rdns          *rdns.Cache
+	risk          *risk.Engine
+	// acceptLinks, authLinks and execLinks are where each feature's links
+	// start in links, so a feature that fails to start can be unloaded.
+	acceptLinks   int
+	authLinks     int
+	execLinks     int
+	// netnsChecked counts accept events whose kernel netns matched /proc,
+	// or is -1 once one did not.
+	netnsChecked  atomic.Int32
 }
 
-func NewMonitor(logger *logger.Logger) *Monitor {
+func NewMonitor(logger *logger.Logger, cfg *config.Config, alerts *alert.Dispatcher) *Monitor {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Monitor{
+	m := &Monitor{
 		logger:        logger,
 		links:         make([]link.Link, 0),
 		ctx:           ctx,
 		cancel:        cancel,
 		failureCounts: make(map[string]int),
+		containers:    container.NewResolver(),
+		alerts:        alerts,
+		serviceCounters: make(map[string]*window.Counter),
+		sessions:      newSessionTable(),
+		sockets:       sockdiag.NewResolver(250 * time.Millisecond),
+		health:        health.NewTracker(),
+		proc:          procfs.Host(),
+		pool:          pipeline.New(cfg.Pipeline.QueueSize, cfg.Pipeline.Workers, cfg.Pipeline.OverflowPolicy()),
 	}
+	m.cfg.Store(cfg)
+	m.pool.Start()
+	return m
 }
 
 func (m *Monitor) LoadBPF(bpfObjFile string) error {
@@ -80,7 +159,7 @@ func (m *Monitor) LoadBPF(bpfObjFile string) error {
 		return fmt.Errorf("failed to remove memlock limit: %w", err)
 	}
 
-	absPath, err := filepath.Abs(bpfObjFile)
+	absPath, err := filepath.Abs(ObjectPath(bpfObjFile))
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
@@ -89,6 +168,9 @@ func (m *Monitor) LoadBPF(bpfObjFile string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load BPF collection spec: %w", err)
 	}
+	if err := checkObject(spec, absPath); err != nil {
+		return err
+	}
 
 	coll, err := ebpf.NewCollection(spec)
 	if err != nil {
@@ -96,6 +178,7 @@ func (m *Monitor) LoadBPF(bpfObjFile string) error {
 	}
 
 	m.collection = coll
+	m.acceptLinks = len(m.links)
 
 	return nil
 }
@@ -105,7 +188,7 @@ func (m *Monitor) LoadAuthBPF(bpfObjFile string) error {
 		return fmt.Errorf("failed to remove memlock limit: %w", err)
 	}
 
-	absPath, err := filepath.Abs(bpfObjFile)
+	absPath, err := filepath.Abs(ObjectPath(bpfObjFile))
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
@@ -114,6 +197,9 @@ func (m *Monitor) LoadAuthBPF(bpfObjFile string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load auth BPF collection spec: %w", err)
 	}
+	if err := checkObject(spec, absPath); err != nil {
+		return err
+	}
 
 	coll, err := ebpf.NewCollection(spec)
 	if err != nil {
@@ -121,49 +207,77 @@ func (m *Monitor) LoadAuthBPF(bpfObjFile string) error {
 	}
 
 	m.authCollection = coll
+	m.authLinks = len(m.links)
 
 	return nil
 }
 
+func loadCollection(bpfObjFile string) (*ebpf.Collection, error) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, fmt.Errorf("failed to remove memlock limit: %w", err)
+	}
+
+	absPath, err := filepath.Abs(ObjectPath(bpfObjFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	spec, err := ebpf.LoadCollectionSpec(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection spec: %w", err)
+	}
+	if err := checkObject(spec, absPath); err != nil {
+		return nil, err
+	}
+
+	return ebpf.NewCollection(spec)
+}
+
+// Attach attaches the accept kretprobe, which reads the peer straight from
+// the new socket. Only when that fails does it fall back to the accept
+// syscall tracepoints, whose events carry the fd and are resolved through
+// /proc; attaching both would report every connection twice.
 func (m *Monitor) Attach() error {
+	if m.collection == nil {
+		return fmt.Errorf("BPF collection not loaded")
+	}
+
 	progKretprobe := m.collection.Programs["kretprobe_inet_csk_accept"]
 	if progKretprobe != nil {
 		kp, err := link.Kretprobe("inet_csk_accept", progKretprobe, nil)
-		if err != nil {
-			m.logger.LogError("Failed to attach kretprobe inet_csk_accept: %v", err)
-			m.logger.LogInfo("Falling back to /proc/net/tcp parsing (may have race conditions)")
-		} else {
+		if err == nil {
 			m.links = append(m.links, kp)
+			m.health.RegisterProbe("inet_csk_accept")
 			m.logger.LogInfo("Successfully attached kretprobe: inet_csk_accept (capturing IP/port directly from kernel)")
+			return nil
 		}
+		m.logger.LogError("Failed to attach kretprobe inet_csk_accept: %v", err)
+		m.logger.LogInfo("Falling back to accept tracepoints and /proc socket lookups")
 	}
 
-	progAccept4 := m.collection.Programs["trace_exit_accept4"]
-	if progAccept4 != nil {
-		tpAccept4, err := link.Tracepoint("syscalls", "sys_exit_accept4", progAccept4, nil)
-		if err != nil {
-			m.logger.LogError("Failed to attach tracepoint accept4: %v", err)
-		} else {
-			m.links = append(m.links, tpAccept4)
-			m.logger.LogInfo("Successfully attached to tracepoint: sys_exit_accept4")
+	attached := 0
+	for _, tp := range []struct{ name, prog string }{
+		{"sys_exit_accept4", "trace_exit_accept4"},
+		{"sys_exit_accept", "trace_exit_accept"},
+	} {
+		prog := m.collection.Programs[tp.prog]
+		if prog == nil {
+			continue
 		}
-	}
-
-	progAccept := m.collection.Programs["trace_exit_accept"]
-	if progAccept != nil {
-		tpAccept, err := link.Tracepoint("syscalls", "sys_exit_accept", progAccept, nil)
+		l, err := link.Tracepoint("syscalls", tp.name, prog, nil)
 		if err != nil {
-			m.logger.LogError("Failed to attach tracepoint accept: %v", err)
-		} else {
-			m.links = append(m.links, tpAccept)
-			m.logger.LogInfo("Successfully attached to tracepoint: sys_exit_accept")
+			m.logger.LogError("Failed to attach tracepoint %s: %v", tp.name, err)
+			continue
 		}
+		m.links = append(m.links, l)
+		attached++
+		m.logger.LogInfo("Successfully attached to tracepoint: %s", tp.name)
 	}
 
-	if len(m.links) == 0 {
+	if attached == 0 {
 		return fmt.Errorf("failed to attach any programs")
 	}
-
+	m.health.RegisterProbe("sys_exit_accept")
 	return nil
 }
 
@@ -171,76 +285,104 @@ func (m *Monitor) AttachAuthUprobe() error {
 	if m.authCollection == nil {
 		return fmt.Errorf("auth BPF collection not loaded")
 	}
-	
-	pamLibPath := "/lib/x86_64-linux-gnu/libpam.so.0"
-	if _, err := os.Stat(pamLibPath); err != nil {
-		altPaths := []string{
-			"/usr/lib/x86_64-linux-gnu/libpam.so.0",
-			"/lib/libpam.so.0",
-			"/usr/lib/libpam.so.0",
-		}
-		found := false
-		for _, path := range altPaths {
-			if _, err := os.Stat(path); err == nil {
-				pamLibPath = path
-				found = true
-				break
-			}
-		}
-		if !found {
-			return fmt.Errorf("libpam.so.0 not found in standard locations")
+
+	libs := pamlib.Discover(m.proc, m.pamComms())
+	if len(libs) == 0 {
+		return fmt.Errorf("%s not found in running processes, the ld.so cache or standard locations", pamlib.Soname)
+	}
+
+	attached := 0
+	for _, lib := range libs {
+		if err := m.attachPAMLibrary(lib); err != nil {
+			m.logger.LogError("Skipping %s (%s): %v", lib.Path, lib.Source, err)
+			continue
 		}
+		attached++
+	}
+	if attached == 0 {
+		return fmt.Errorf("failed to attach to any of %d libpam candidates", len(libs))
 	}
+	return nil
+}
+
+// pamComms are the process names whose libpam mappings are probed first.
+func (m *Monitor) pamComms() []string {
+	cfg := m.config()
+	comms := []string{"sshd", "sshd-session"}
+	for _, svc := range cfg.Services {
+		comms = append(comms, svc.Processes...)
+	}
+	return append(comms, cfg.PAMServices...)
+}
 
-	up, err := link.OpenExecutable(pamLibPath)
+func (m *Monitor) attachPAMLibrary(lib pamlib.Library) error {
+	syms, err := pamlib.ReadSymbols(lib.Path, pamlib.Functions...)
 	if err != nil {
-		return fmt.Errorf("failed to open executable %s: %w", pamLibPath, err)
+		return err
 	}
-	
-	progUprobe := m.authCollection.Programs["uprobe_pam_authenticate"]
-	if progUprobe != nil {
-		uprobeLink, err := up.Uprobe("pam_authenticate", progUprobe, nil)
-		if err != nil {
-			m.logger.LogInfo("Symbol-based attachment failed, trying offset-based: %v", err)
-			uprobeLink, err = up.Uprobe("", progUprobe, &link.UprobeOptions{
-				Offset: 0x9940, 
-			})
-			if err != nil {
-				return fmt.Errorf("failed to attach uprobe to pam_authenticate (both symbol and offset failed): %w", err)
-			}
-			m.logger.LogInfo("Successfully attached uprobe using offset 0x9940")
-		} else {
-			m.logger.LogInfo("Successfully attached uprobe to pam_authenticate using symbol")
-		}
-		m.links = append(m.links, uprobeLink)
-	} else {
-		m.logger.LogError("uprobe_pam_authenticate program not found in BPF collection")
+	if _, ok := syms["pam_authenticate"]; !ok {
+		return fmt.Errorf("pam_authenticate is not exported")
 	}
 
-	progUretprobe := m.authCollection.Programs["uretprobe_pam_authenticate"]
-	if progUretprobe != nil {
-		uretprobeLink, err := up.Uretprobe("pam_authenticate", progUretprobe, nil)
-		if err != nil {
-			m.logger.LogInfo("Symbol-based uretprobe attachment failed, trying offset-based: %v", err)
-			uretprobeLink, err = up.Uretprobe("", progUretprobe, &link.UprobeOptions{
-				Offset: 0x9940, 
-			})
-			if err != nil {
-				return fmt.Errorf("failed to attach uretprobe to pam_authenticate (both symbol and offset failed): %w", err)
+	up, err := link.OpenExecutable(lib.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open executable: %w", err)
+	}
+
+	for _, symbol := range pamlib.Functions {
+		offset, ok := syms[symbol]
+		if !ok {
+			m.logger.LogError("%s does not export %s", lib.Path, symbol)
+			continue
+		}
+		if err := m.attachPAMSymbol(up, symbol, offset); err != nil {
+			if symbol == "pam_authenticate" {
+				return err
 			}
-			m.logger.LogInfo("Successfully attached uretprobe using offset 0x9940")
-		} else {
-			m.logger.LogInfo("Successfully attached uretprobe to pam_authenticate using symbol")
+			m.logger.LogError("Failed to attach %s in %s: %v", symbol, lib.Path, err)
+			continue
 		}
-		m.links = append(m.links, uretprobeLink)
-	} else {
-		m.logger.LogError("uretprobe_pam_authenticate program not found in BPF collection")
+		m.logger.LogInfo("Attached uprobe and uretprobe to %s in %s at offset %#x (found via %s)",
+			symbol, lib.Path, offset, lib.Source)
+	}
+
+	m.pamLibraries = append(m.pamLibraries, lib)
+	return nil
+}
+
+func (m *Monitor) attachPAMSymbol(up *link.Executable, symbol string, offset uint64) error {
+	progUprobe := m.authCollection.Programs["uprobe_"+symbol]
+	progUretprobe := m.authCollection.Programs["uretprobe_"+symbol]
+	if progUprobe == nil || progUretprobe == nil {
+		return fmt.Errorf("%s probes not found in BPF collection", symbol)
+	}
+
+	opts := &link.UprobeOptions{Address: offset}
+	uprobeLink, err := up.Uprobe(symbol, progUprobe, opts)
+	if err != nil {
+		return fmt.Errorf("failed to attach uprobe: %w", err)
 	}
 
+	uretprobeLink, err := up.Uretprobe(symbol, progUretprobe, opts)
+	if err != nil {
+		uprobeLink.Close()
+		return fmt.Errorf("failed to attach uretprobe: %w", err)
+	}
+
+	m.links = append(m.links, uprobeLink, uretprobeLink)
+	m.health.RegisterProbe(symbol)
 	return nil
 }
 
+func (m *Monitor) PAMLibraries() []pamlib.Library {
+	return m.pamLibraries
+}
+
 func (m *Monitor) StartPerfReader() error {
+	if m.collection == nil {
+		return fmt.Errorf("BPF collection not loaded")
+	}
+
 	eventsMap := m.collection.Maps["events"]
 	if eventsMap == nil {
 		return fmt.Errorf("failed to find events map")
@@ -275,186 +417,41 @@ func (m *Monitor) StartAuthPerfReader() error {
 }
 
 func (m *Monitor) ProcessEvents() {
-	m.wg.Add(1)
-	defer m.wg.Done()
-
-	for {
-		if atomic.LoadInt32(&m.shuttingDown) != 0 {
-			return
-		}
-
-		select {
-		case <-m.ctx.Done():
-			return
-		default:
-		}
-
-		record, err := m.reader.Read()
+	m.consume(m.reader, "accept", func(raw []byte) (uint32, func(), error) {
+		ev, err := DecodeAcceptEvent(raw)
 		if err != nil {
-			if atomic.LoadInt32(&m.shuttingDown) != 0 {
-				return
-			}
-
-			if m.ctx.Err() != nil {
-				return
-			}
-
-			if err == perf.ErrClosed {
-				return
-			}
-
-			errStr := err.Error()
-			if strings.Contains(errStr, "file already closed") ||
-				strings.Contains(errStr, "perf ringbuffer") ||
-				strings.Contains(errStr, "epoll wait") {
-				return
-			}
-
-			if atomic.LoadInt32(&m.shuttingDown) == 0 {
-				m.logger.LogError("Error reading perf event: %v", err)
-			}
-			continue
-		}
-
-		if atomic.LoadInt32(&m.shuttingDown) != 0 {
-			return
+			return 0, nil, err
 		}
-
-		select {
-		case <-m.ctx.Done():
-			return
-		default:
-		}
-
-		if record.LostSamples > 0 {
-			m.logger.LogError("Lost %d samples", record.LostSamples)
-			continue
-		}
-
-		if len(record.RawSample) < int(unsafe.Sizeof(AcceptEvent{})) {
-			continue
-		}
-
-		var ev AcceptEvent
-		reader := bytes.NewReader(record.RawSample)
-		if err := binary.Read(reader, binary.LittleEndian, &ev); err != nil {
-			ev = *(*AcceptEvent)(unsafe.Pointer(&record.RawSample[0]))
-		}
-		
-		comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
-		if comm != "" {
-			m.logger.LogInfo("Received event: comm=%s, tgid=%d, fd=%d, has_sock_info=%d, raw_len=%d", 
-				comm, ev.Tgid, ev.Fd, ev.HasSockInfo, len(record.RawSample))
-		}
-
-		if ev.HasSockInfo == 1 {
-			peerIPOffset := 36
-			peerPortOffset := 40
-			localIPOffset := 42
-			localPortOffset := 46
-			if len(record.RawSample) >= 49 { 
-				ev.PeerIP = binary.BigEndian.Uint32(record.RawSample[peerIPOffset : peerIPOffset+4])
-				ev.PeerPort = binary.BigEndian.Uint16(record.RawSample[peerPortOffset : peerPortOffset+2])
-				ev.LocalIP = binary.BigEndian.Uint32(record.RawSample[localIPOffset : localIPOffset+4])
-				ev.LocalPort = binary.BigEndian.Uint16(record.RawSample[localPortOffset : localPortOffset+2])
-			} else {
-				ev.HasSockInfo = 0
-			}
+		if ev.Fd >= 0 {
+			m.health.ProbeFired("sys_exit_accept")
+		} else {
+			m.health.ProbeFired("inet_csk_accept")
 		}
-
-		m.handleEvent(&ev)
-	}
+		return acceptKey(ev), func() { m.handleEvent(ev) }, nil
+	})
 }
 
 func (m *Monitor) ProcessAuthEvents() {
-	m.wg.Add(1)
-	defer m.wg.Done()
-
-	if m.authReader == nil {
-		return
-	}
-
-	for {
-		if atomic.LoadInt32(&m.shuttingDown) != 0 {
-			return
-		}
-
-		select {
-		case <-m.ctx.Done():
-			return
-		default:
-		}
-
-		record, err := m.authReader.Read()
+	m.consume(m.authReader, "auth", func(raw []byte) (uint32, func(), error) {
+		ev, err := DecodeAuthEvent(raw)
 		if err != nil {
-			if atomic.LoadInt32(&m.shuttingDown) != 0 {
-				return
-			}
-
-			if m.ctx.Err() != nil {
-				return
-			}
-
-			if err == perf.ErrClosed {
-				return
-			}
-
-			errStr := err.Error()
-			if strings.Contains(errStr, "file already closed") ||
-				strings.Contains(errStr, "perf ringbuffer") ||
-				strings.Contains(errStr, "epoll wait") {
-				return
-			}
-
-			if atomic.LoadInt32(&m.shuttingDown) == 0 {
-				m.logger.LogError("Error reading auth perf event: %v", err)
-			}
-			continue
-		}
-
-		if atomic.LoadInt32(&m.shuttingDown) != 0 {
-			return
+			return 0, nil, err
 		}
-
-		select {
-		case <-m.ctx.Done():
-			return
-		default:
-		}
-
-		if record.LostSamples > 0 {
-			m.logger.LogError("Lost %d auth samples", record.LostSamples)
-			continue
-		}
-
-		if len(record.RawSample) < int(unsafe.Sizeof(AuthEvent{})) {
-			continue
-		}
-
-		var ev AuthEvent
-		reader := bytes.NewReader(record.RawSample)
-		if err := binary.Read(reader, binary.LittleEndian, &ev); err != nil {
-			ev = *(*AuthEvent)(unsafe.Pointer(&record.RawSample[0]))
-		}
-
-		comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
-		m.logger.LogInfo("Received auth event: comm=%s, tgid=%d, ret_code=%d, is_failure=%d, raw_len=%d",
-			comm, ev.Tgid, ev.RetCode, ev.IsFailure, len(record.RawSample))
-
-		m.handleAuthEvent(&ev)
-	}
+		m.health.ProbeFired(ev.ProbeName())
+		return ev.Tgid, func() { m.handleAuthEvent(ev) }, nil
+	})
 }
 
 func (m *Monitor) extractIPFromProcess(pid uint32) (string, error) {
-	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
-	files, err := os.ReadDir(fdDir)
+	fdDir := procfs.PidPath(pid, "fd")
+	files, err := m.proc.ReadDir(fdDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to read fd directory: %w", err)
 	}
 
 	for _, file := range files {
-		fdPath := fmt.Sprintf("%s/%s", fdDir, file.Name())
-		linkTarget, err := os.Readlink(fdPath)
+		fdPath := path.Join(fdDir, file.Name())
+		linkTarget, err := m.proc.Readlink(fdPath)
 		if err != nil {
 			continue
 		}
@@ -467,8 +464,12 @@ func (m *Monitor) extractIPFromProcess(pid uint32) (string, error) {
 		if err != nil {
 			continue
 		}
+		fd, err := strconv.Atoi(file.Name())
+		if err != nil {
+			continue
+		}
 
-		ip, _, _, err := inodeToIPPort(inode)
+		ip, _, _, err := m.inodeToIPPort(pid, fd, inode)
 		if err == nil && ip != "" && ip != "0.0.0.0" {
 			return ip, nil
 		}
@@ -477,112 +478,344 @@ func (m *Monitor) extractIPFromProcess(pid uint32) (string, error) {
 	return "", fmt.Errorf("no socket found for PID %d", pid)
 }
 
+func (ev *AuthEvent) ProbeName() string {
+	switch ev.Kind {
+	case AuthKindAcctMgmt:
+		return "pam_acct_mgmt"
+	case AuthKindOpenSession:
+		return "pam_open_session"
+	case AuthKindCloseSession:
+		return "pam_close_session"
+	}
+	return "pam_authenticate"
+}
+
+func (ev *AuthEvent) RemoteIP() string {
+	rhost := strings.TrimRight(string(ev.RHost[:]), "\x00")
+	if ip := net.ParseIP(rhost); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func (ev *AuthEvent) PAMService() string {
+	service := strings.TrimRight(string(ev.Service[:]), "\x00")
+	if service != "" {
+		return service
+	}
+
+	comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
+	if strings.Contains(comm, "sshd") {
+		return "sshd"
+	}
+	return comm
+}
+
 func (m *Monitor) handleAuthEvent(ev *AuthEvent) {
 	comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
+	service := ev.PAMService()
 
-	m.logger.LogInfo("Processing auth event: comm='%s', tgid=%d, ret_code=%d, is_failure=%d",
-		comm, ev.Tgid, ev.RetCode, ev.IsFailure)
+	m.logger.LogInfo("Processing auth event: comm='%s', service='%s', tgid=%d, ret_code=%d, is_failure=%d",
+		comm, service, ev.Tgid, ev.RetCode, ev.IsFailure)
 
-	if !strings.Contains(comm, "sshd") {
-		m.logger.LogInfo("Skipping non-sshd event: comm='%s'", comm)
+	if ev.Kind == AuthKindAuthenticate && m.config().PrivEsc.Covers(service) {
+		netns := m.netnsOf(ev.Tgid)
+		m.handlePrivEscEvent(ev, append([]logger.Field{logger.F("pam_service", service)}, m.eventFields(ev.CgroupID, ev.Tgid, netns)...))
+		return
+	}
+
+	if !m.config().MonitorsPAMService(service) {
+		m.logger.LogInfo("Skipping unmonitored PAM service: service='%s', comm='%s'", service, comm)
 		return
 	}
 	
-	if comm != "sshd" {
+	if strings.Contains(comm, "sshd") && comm != "sshd" {
 		idx := strings.Index(comm, "sshd")
 		if idx >= 0 {
 			comm = comm[idx:]
 		}
 	}
 
+	netns := m.netnsOf(ev.Tgid)
+	if ns := m.config().Namespace(netns); ns != nil && ns.Ignore {
+		return
+	}
+
+	if ev.Kind != AuthKindAuthenticate {
+		m.handleSessionEvent(ev, service, netns)
+		return
+	}
+
 	isFailure := ev.RetCode != 0
+	m.sessions.recordAuth(ev.Tgid, !isFailure)
 	
-	var ip string
-	var err error
-	for retry := 0; retry < 5; retry++ {
-		if retry > 0 {
-			time.Sleep(time.Duration(retry*10) * time.Millisecond) 
-		}
+	m.resolveAuth(ev, comm, service, netns, 0)
+}
+
+// resolveAuth finds the address an authentication came from: the rhost
+// PAM was given or else the peer of a socket the process holds, which may
+// not be visible yet. Lookups are retried through the pool while the
+// process is alive, and the result is then logged and scored.
+func (m *Monitor) resolveAuth(ev *AuthEvent, comm, service string, netns uint64, attempt int) {
+	ip := ev.RemoteIP()
+	if ip == "" {
+		var err error
 		ip, err = m.extractIPFromProcess(ev.Tgid)
-		if err == nil && ip != "" {
-			break
-		}
-	}
-	
-	if err != nil || ip == "" {
-		procPath := fmt.Sprintf("/proc/%d", ev.Tgid)
-		if _, err2 := os.Stat(procPath); err2 == nil {
-			time.Sleep(50 * time.Millisecond)
-			ip, err = m.extractIPFromProcess(ev.Tgid)
-		}
-		
 		if err != nil || ip == "" {
+			if _, statErr := fs.Stat(m.proc, procfs.PidPath(ev.Tgid)); statErr == nil && attempt < len(retryDelays) {
+				m.pool.SubmitAfter("auth", ev.Tgid, retryDelays[attempt], func() {
+					m.resolveAuth(ev, comm, service, netns, attempt+1)
+				})
+				return
+			}
 			ip = "unknown"
 			m.logger.LogInfo("Could not extract IP for PID %d after retries, using fallback: %v", ev.Tgid, err)
 		}
 	}
+	isFailure := ev.RetCode != 0
+
+	fields := append([]logger.Field{logger.F("pam_service", service)}, m.eventFields(ev.CgroupID, ev.Tgid, netns)...)
+	addr, _ := netip.ParseAddr(ip)
+	info := m.geo.Lookup(addr)
+	matches := m.intel.Lookup(addr)
+	fields = append(fields, info.Fields()...)
+	fields = append(fields, threatintel.Fields(matches)...)
+	fields = append(fields, m.hostnameFields(addr)...)
+	failureKey := fmt.Sprintf("%d/%s/%s", netns, service, ip)
+
+	if m.blocked("login", func(g *config.GeoFence) bool { return g.CoversPAMService(service) }, addr, info, matches, fields) {
+		m.cutLogin(ev.Tgid, addr, fields)
+	}
 
 	if isFailure {
+		ch := m.risk.Failure(addr, strings.TrimRight(string(ev.User[:]), "\x00"))
+		if m.riskBand(ch, fields) {
+			m.cutLogin(ev.Tgid, addr, fields)
+		}
+		if ch.Score.Addr.IsValid() {
+			fields = append(fields, logger.F("risk_score", ch.Score.Score))
+		}
+
 		m.failureMutex.Lock()
-		m.failureCounts[ip]++
-		failureCount := m.failureCounts[ip]
+		m.failureCounts[failureKey]++
+		failureCount := m.failureCounts[failureKey]
 		m.failureMutex.Unlock()
 
-		m.logger.LogSSHDetected(ip, 0, ev.Tgid, comm)
-		m.logger.LogInfo("Authentication failure from %s (PAM return code: %d, is_failure flag: %d, total failures: %d)", 
+		if service == "sshd" {
+			m.logger.LogSSHDetected(ip, 0, ev.Tgid, comm, fields...)
+		} else {
+			m.logger.LogServiceDetected(service, ip, 0, ev.Tgid, comm, fields...)
+		}
+		m.logger.LogInfoFields(fields, "Authentication failure from %s (PAM return code: %d, is_failure flag: %d, total failures: %d)", 
 			ip, ev.RetCode, ev.IsFailure, failureCount)
 	} else {
+		m.risk.Success(addr, info.CountryCode)
 		m.failureMutex.Lock()
-		delete(m.failureCounts, ip)
+		delete(m.failureCounts, failureKey)
 		m.failureMutex.Unlock()
-		m.logger.LogInfo("Successful authentication from %s (PID: %d)", ip, ev.Tgid)
+		m.logger.LogInfoFields(fields, "Successful authentication from %s (PID: %d)", ip, ev.Tgid)
 	}
 }
 
 func (m *Monitor) handleEvent(ev *AcceptEvent) {
-	comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
-
-	var ip string
-	var remPort, localPort int
+	netns := m.acceptNetns(ev)
+	if ns := m.config().Namespace(netns); ns != nil && ns.Ignore {
+		return
+	}
 
 	if ev.HasSockInfo == 1 {
 		ipBytes := make([]byte, 4)
 		binary.BigEndian.PutUint32(ipBytes, ev.PeerIP)
-		ip = fmt.Sprintf("%d.%d.%d.%d", ipBytes[0], ipBytes[1], ipBytes[2], ipBytes[3])
+		ip := fmt.Sprintf("%d.%d.%d.%d", ipBytes[0], ipBytes[1], ipBytes[2], ipBytes[3])
 
-		remPort = int(ev.PeerPort)
-		localPort = int(ev.LocalPort)
-		
-		m.logger.LogInfo("BPF captured: comm=%s, peer=%s:%d, local_port=%d, has_sock_info=%d", 
-			comm, ip, remPort, localPort, ev.HasSockInfo)
-	} else {
-		linkPath := fmt.Sprintf("/proc/%d/fd/%d", ev.Tgid, ev.Fd)
-		linkTarget, err := os.Readlink(linkPath)
-		if err != nil {
-			return
-		}
+		var localBytes [4]byte
+		binary.BigEndian.PutUint32(localBytes[:], ev.LocalIP)
+		local := netip.AddrPortFrom(netip.AddrFrom4(localBytes), ev.LocalPort)
 
-		inode, err := parseInodeFromLink(linkTarget)
-		if err != nil {
-			return
-		}
+		m.handleConnection(ev, netns, ip, int(ev.PeerPort), local)
+		return
+	}
 
-		time.Sleep(10 * time.Millisecond)
+	linkPath := procfs.PidPath(ev.Tgid, "fd", strconv.Itoa(int(ev.Fd)))
+	linkTarget, err := m.proc.Readlink(linkPath)
+	if err != nil {
+		return
+	}
+	inode, err := parseInodeFromLink(linkTarget)
+	if err != nil {
+		return
+	}
+	m.resolveAccept(ev, netns, inode, 0)
+}
 
-		var err2 error
-		ip, remPort, localPort, err2 = inodeToIPPort(inode)
-		if err2 != nil {
-			return
-		}
+// resolveAccept finds the peer of a socket the accept tracepoints reported
+// by fd. While the socket is not visible yet the lookup is re-submitted
+// after the next retry delay.
+func (m *Monitor) resolveAccept(ev *AcceptEvent, netns uint64, inode uint64, attempt int) {
+	ip, remPort, local, err := m.inodeToIPPort(ev.Tgid, int(ev.Fd), inode)
+	if errors.Is(err, errNotVisible) && attempt < len(retryDelays) {
+		m.pool.SubmitAfter("accept", acceptKey(ev), retryDelays[attempt], func() {
+			m.resolveAccept(ev, netns, inode, attempt+1)
+		})
+		return
+	}
+	if err != nil {
+		return
+	}
+	m.handleConnection(ev, netns, ip, remPort, local)
+}
+
+// acceptKey picks the pool shard of an accept event. Accepts all come from
+// the same listener process, so the key varies per connection instead:
+// the peer address and port, or the fd and time for tracepoint events.
+func acceptKey(ev *AcceptEvent) uint32 {
+	if ev.HasSockInfo == 1 {
+		return (ev.PeerIP ^ uint32(ev.PeerPort)) * 2654435761
+	}
+	return (uint32(ev.Fd) ^ uint32(ev.TsNs)) * 2654435761
+}
+
+// handleConnection matches an accepted connection from ip:remPort to local
+// against the configured services and policies.
+func (m *Monitor) handleConnection(ev *AcceptEvent, netns uint64, ip string, remPort int, local netip.AddrPort) {
+	comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
+	localPort := int(local.Port())
+
+	svc := m.config().Service(localPort, comm, m.netnsName(netns))
+	addr, _ := netip.ParseAddr(ip)
+	info := m.geo.Lookup(addr)
+	matches := m.intel.Lookup(addr)
+	fields := m.eventFields(ev.CgroupID, ev.Tgid, netns)
+	fields = append(fields, info.Fields()...)
+	fields = append(fields, threatintel.Fields(matches)...)
+	fields = append(fields, m.hostnameFields(addr)...)
+
+	if svc == nil {
+		m.logger.LogEvent(ip, remPort, ev.Tgid, comm, fields...)
+		return
+	}
+	if svc.Policy.Ignore {
+		return
+	}
+
+	fields = append(fields, logger.F("local_port", localPort))
+	m.logger.LogServiceDetected(svc.Name, ip, remPort, ev.Tgid, comm, fields...)
+
+	if m.blocked("connection", func(g *config.GeoFence) bool { return g.CoversService(svc.Name) }, addr, info, matches, fields) {
+		m.cutConnection(ev.Tgid, local, netip.AddrPortFrom(addr, uint16(remPort)), fields)
+		return
+	}
+	if m.scoreConnection(svc, addr, info.CountryCode, matches, fields) {
+		m.cutConnection(ev.Tgid, local, netip.AddrPortFrom(addr, uint16(remPort)), fields)
+		return
 	}
+	m.recordServiceConnection(svc, ip, netns, fields)
+}
 
-	isSSH := localPort == 22 || remPort == 22 || comm == "sshd"
+func (m *Monitor) eventFields(cgroupID uint64, tgid uint32, netns uint64) []logger.Field {
+	var fields []logger.Field
 
-	if isSSH {
-		m.logger.LogSSHDetected(ip, remPort, ev.Tgid, comm)
+	info := m.containers.Resolve(cgroupID, tgid)
+	if info.InContainer() {
+		fields = append(fields,
+			logger.F("container", info.ShortID()),
+			logger.F("container_name", info.Name),
+			logger.F("runtime", info.Runtime))
 	} else {
-		m.logger.LogEvent(ip, remPort, ev.Tgid, comm)
+		fields = append(fields, logger.F("cgroup", info.Path))
+	}
+
+	if netns != 0 {
+		fields = append(fields, logger.F("netns", netns), logger.F("netns_name", m.netnsName(netns)))
+	}
+
+	return fields
+}
+
+// hostnameFields returns the cached reverse DNS name of addr. A miss
+// queues a lookup in the background and the next event gets the name.
+func (m *Monitor) hostnameFields(addr netip.Addr) []logger.Field {
+	res, ok := m.rdns.Lookup(addr)
+	if !ok {
+		return nil
 	}
+	return res.Fields()
+}
+
+func (m *Monitor) netnsOf(tgid uint32) uint64 {
+	linkTarget, err := m.proc.Readlink(procfs.PidPath(tgid, "ns", "net"))
+	if err != nil {
+		return 0
+	}
+	inode, err := parseInodeFromLink(linkTarget)
+	if err != nil {
+		return 0
+	}
+	return inode
+}
+
+// netnsChecks is how many accept events must agree with /proc before the
+// namespace the kretprobe reports is used without checking.
+const netnsChecks = 16
+
+// acceptNetns returns the network namespace of an accept event. The
+// kretprobe reads it through fixed struct offsets, which differ between
+// kernel builds, so it is compared with /proc/<pid>/ns/net until it has
+// matched netnsChecks times. After a mismatch only /proc is used.
+func (m *Monitor) acceptNetns(ev *AcceptEvent) uint64 {
+	kernel := uint64(ev.Netns)
+	checked := m.netnsChecked.Load()
+	if kernel == 0 || checked < 0 {
+		return m.netnsOf(ev.Tgid)
+	}
+	if checked >= netnsChecks {
+		return kernel
+	}
+
+	proc := m.netnsOf(ev.Tgid)
+	if proc == 0 {
+		return kernel
+	}
+	if proc != kernel {
+		if m.netnsChecked.Swap(-1) >= 0 {
+			m.logger.LogError("BPF reported network namespace %d for PID %d but /proc has %d; the kernel struct offsets do not match, reading namespaces from /proc",
+				kernel, ev.Tgid, proc)
+		}
+		return proc
+	}
+	m.netnsChecked.CompareAndSwap(checked, checked+1)
+	return kernel
+}
+
+func (m *Monitor) SetProcFS(fsys procfs.FS) {
+	m.proc = fsys
+	m.containers.SetProcFS(fsys)
+}
+
+// SetGeoIP enables address enrichment for accept and auth events.
+func (m *Monitor) SetGeoIP(geo *geoip.Enricher) {
+	m.geo = geo
+}
+
+// SetThreatIntel enables tagging events with the reputation feeds that
+// list their address.
+func (m *Monitor) SetThreatIntel(intel *threatintel.Feeds) {
+	m.intel = intel
+}
+
+// SetReverseDNS adds cached PTR names to accept and auth events.
+func (m *Monitor) SetReverseDNS(c *rdns.Cache) {
+	m.rdns = c
+}
+
+// SetRisk enables per-address risk scoring of connections and logins.
+func (m *Monitor) SetRisk(e *risk.Engine) {
+	m.risk = e
+}
+
+// SetResponder enables bans and the actions that enforce them.
+func (m *Monitor) SetResponder(r *response.Responder) {
+	m.response = r
 }
 
 func (m *Monitor) Stop() {
@@ -596,8 +829,15 @@ func (m *Monitor) Stop() {
 	if m.authReader != nil {
 		m.authReader.Close()
 	}
+	if m.execReader != nil {
+		m.execReader.Close()
+	}
+	if m.connectReader != nil {
+		m.connectReader.Close()
+	}
 	
 	m.wg.Wait()
+	m.pool.Stop()
 }
 
 func (m *Monitor) Close() error {
@@ -612,9 +852,57 @@ func (m *Monitor) Close() error {
 	if m.authCollection != nil {
 		m.authCollection.Close()
 	}
+	if m.execCollection != nil {
+		m.execCollection.Close()
+	}
+	m.sockets.Close()
 	return nil
 }
 
+// UnloadBPF undoes a partly started accept feature: it closes the links
+// attached since LoadBPF, the perf reader and the collection.
+func (m *Monitor) UnloadBPF() {
+	m.unload(&m.collection, &m.reader, m.acceptLinks, "inet_csk_accept", "sys_exit_accept")
+}
+
+// UnloadAuthBPF undoes a partly started auth feature.
+func (m *Monitor) UnloadAuthBPF() {
+	m.unload(&m.authCollection, &m.authReader, m.authLinks, pamlib.Functions...)
+	m.pamLibraries = nil
+}
+
+// UnloadExecBPF undoes a partly started exec feature. Connect shares the
+// exec collection, so it must not be started after this.
+func (m *Monitor) UnloadExecBPF() {
+	probes := make([]string, len(execTracepoints))
+	for i, tp := range execTracepoints {
+		probes[i] = tp.name
+	}
+	m.unload(&m.execCollection, &m.execReader, m.execLinks, probes...)
+}
+
+// unload closes the links from index from on, which belong to the feature
+// being started last, and then its reader and collection.
+func (m *Monitor) unload(coll **ebpf.Collection, rd **perf.Reader, from int, probes ...string) {
+	if from < len(m.links) {
+		for _, l := range m.links[from:] {
+			l.Close()
+		}
+		m.links = m.links[:from]
+	}
+	for _, probe := range probes {
+		m.health.UnregisterProbe(probe)
+	}
+	if *rd != nil {
+		(*rd).Close()
+		*rd = nil
+	}
+	if *coll != nil {
+		(*coll).Close()
+		*coll = nil
+	}
+}
+
 func parseInodeFromLink(linkTarget string) (uint64, error) {
 	start := strings.Index(linkTarget, "[")
 	end := strings.Index(linkTarget, "]")
@@ -631,32 +919,62 @@ func parseInodeFromLink(linkTarget string) (uint64, error) {
 	return inode, nil
 }
 
-func inodeToIPPort(inode uint64) (string, int, int, error) {
-	for retry := 0; retry < 10; retry++ {
-		if retry > 0 {
-			delay := time.Duration(5*(1<<uint(retry-1))) * time.Millisecond
-			if delay > 200*time.Millisecond {
-				delay = 200 * time.Millisecond
-			}
-			time.Sleep(delay)
-		}
+// errNotVisible means a socket was not found yet. A new socket can take a
+// moment to show up, so callers retry later through retryDelays.
+var errNotVisible = errors.New("socket not found")
+
+// retryDelays are the waits between attempts to find a new socket or the
+// peer of a PAM process. Retries are re-submitted to the pool rather than
+// slept on the worker.
+var retryDelays = []time.Duration{
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	40 * time.Millisecond,
+	80 * time.Millisecond,
+	160 * time.Millisecond,
+}
 
-		ip, remPort, localPort, err := parseTCPFile("/proc/net/tcp", inode)
-		if err == nil {
-			return ip, remPort, localPort, nil
+// inodeToIPPort looks the socket behind descriptor fd of pid up once:
+// through its 4-tuple where the descriptor can be duplicated, otherwise by
+// inode through a sock_diag dump or, where that is unavailable too,
+// /proc/<pid>/net/tcp{,6}. The local address is only known from sock_diag.
+func (m *Monitor) inodeToIPPort(pid uint32, fd int, inode uint64) (string, int, netip.AddrPort, error) {
+	s, err := m.sockets.ByFD(pid, fd)
+	if err == nil && uint64(s.Inode) != inode {
+		// The descriptor was closed and reused since it was read.
+		err = sockdiag.ErrNotFound
+	}
+	if errors.Is(err, sockdiag.ErrUnavailable) {
+		s, err = m.sockets.ByInode(pid, inode)
+	}
+	if err == nil {
+		if s.Listening() || !s.Remote.Addr().IsValid() || s.Remote.Addr().IsUnspecified() {
+			return "", 0, netip.AddrPort{}, fmt.Errorf("socket %d has no peer", inode)
 		}
+		return s.Remote.Addr().Unmap().String(), int(s.Remote.Port()), netip.AddrPortFrom(s.Local.Addr().Unmap(), s.Local.Port()), nil
+	}
+	if errors.Is(err, sockdiag.ErrUnavailable) {
+		ip, remPort, localPort, err := procInodeToIPPort(m.proc, pid, inode)
+		return ip, remPort, netip.AddrPortFrom(netip.Addr{}, uint16(localPort)), err
+	}
+	if errors.Is(err, sockdiag.ErrNotFound) {
+		return "", 0, netip.AddrPort{}, errNotVisible
+	}
+	return "", 0, netip.AddrPort{}, err
+}
 
-		ip, remPort, localPort, err = parseTCPFile("/proc/net/tcp6", inode)
+func procInodeToIPPort(fsys procfs.FS, pid uint32, inode uint64) (string, int, int, error) {
+	for _, name := range []string{"tcp", "tcp6"} {
+		ip, remPort, localPort, err := parseTCPFile(fsys, procfs.PidPath(pid, "net", name), inode)
 		if err == nil {
 			return ip, remPort, localPort, nil
 		}
 	}
-
-	return "", 0, 0, fmt.Errorf("not found")
+	return "", 0, 0, errNotVisible
 }
 
-func parseTCPFile(filename string, inode uint64) (string, int, int, error) {
-	file, err := os.Open(filename)
+func parseTCPFile(fsys procfs.FS, filename string, inode uint64) (string, int, int, error) {
+	file, err := fsys.Open(filename)
 	if err != nil {
 		return "", 0, 0, err
 	}
@@ -670,17 +988,23 @@ func parseTCPFile(filename string, inode uint64) (string, int, int, error) {
 	header := scanner.Text()
 	cols := strings.Fields(header)
 	var idxLocal, idxRem, idxSt, idxInode int = -1, -1, -1, -1
-	for i, c := range cols {
+	i := 0
+	for _, c := range cols {
 		switch c {
+		case "rx_queue", "tm->when":
+			// "tx_queue rx_queue" and "tr tm->when" are single
+			// colon-joined columns in the rows below.
+			continue
 		case "local_address":
 			idxLocal = i
-		case "rem_address":
+		case "rem_address", "remote_address":
 			idxRem = i
 		case "st":
 			idxSt = i
 		case "inode":
 			idxInode = i
 		}
+		i++
 	}
 	if idxLocal == -1 { idxLocal = 1 }
 	if idxRem == -1 { idxRem = 2 }
@@ -721,17 +1045,13 @@ func parseTCPFile(filename string, inode uint64) (string, int, int, error) {
 			continue
 		}
 
-		if remParts[0] == "00000000" && remPortHex == "0000" {
-			continue
-		}
-
 		remIPHex := remParts[0]
-		remIP, err := hexIPv4ToDot(remIPHex)
+		remIP, err := hexToIP(remIPHex)
 		if err != nil {
 			return "", 0, 0, fmt.Errorf("invalid rem ip hex")
 		}
 
-		if remIP == "0.0.0.0" {
+		if remIP.IsUnspecified() {
 			continue
 		}
 
@@ -740,20 +1060,28 @@ func parseTCPFile(filename string, inode uint64) (string, int, int, error) {
 			continue
 		}
 
-		return remIP, int(remPort64), int(localPort64), nil
+		return remIP.String(), int(remPort64), int(localPort64), nil
 	}
 
 	return "", 0, 0, fmt.Errorf("inode not found")
 }
 
-func hexIPv4ToDot(hexStr string) (string, error) {
-	if len(hexStr) != 8 {
-		return "", fmt.Errorf("unexpected ipv4 hex length")
+func hexToIP(hexStr string) (netip.Addr, error) {
+	if len(hexStr) != 8 && len(hexStr) != 32 {
+		return netip.Addr{}, fmt.Errorf("unexpected ip hex length")
 	}
 	b, err := hex.DecodeString(hexStr)
-	if err != nil || len(b) != 4 {
-		return "", fmt.Errorf("decode failed")
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("decode failed")
+	}
+
+	for word := 0; word < len(b); word += 4 {
+		b[word], b[word+3] = b[word+3], b[word]
+		b[word+1], b[word+2] = b[word+2], b[word+1]
+	}
+
+	if len(b) == 4 {
+		return netip.AddrFrom4([4]byte(b)), nil
 	}
-	ip := fmt.Sprintf("%d.%d.%d.%d", b[3], b[2], b[1], b[0])
-	return ip, nil
+	return netip.AddrFrom16([16]byte(b)).Unmap(), nil
 }
\ No newline at end of file
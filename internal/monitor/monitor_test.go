@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"testing"
+
+	"secrds/internal/health"
+	"secrds/internal/logger"
+	"secrds/internal/procfs/procfstest"
+)
+
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func TestParseTCPFile(t *testing.T) {
+	fsys := procfstest.New()
+	fsys.AddFile("1/net/tcp", tcpHeader+
+		"   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0\n"+
+		"   1: 0100A8C0:0016 0200A8C0:D431 01 00000000:00000000 02:000A7D5A 00000000     0        0 1002 4 0000000000000000 20 4 30 10 -1\n"+
+		"   2: 0100A8C0:0016 0300A8C0:C001 06 00000000:00000000 03:00001000 00000000     0        0 0 3 0000000000000000\n")
+	fsys.AddFile("1/net/tcp6", "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"+
+		"   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0\n"+
+		"   1: 0000000000000000FFFF00000100A8C0:0016 0000000000000000FFFF00000400A8C0:E000 01 00000000:00000000 02:00000F00 00000000     0        0 2002 1 0000000000000000 20 4 30 10 -1\n"+
+		"   2: B80D0120000000000000000001000000:08AE B80D0120000000000000000005000000:9C40 01 00000000:00000000 02:00000F00 00000000  1000        0 2003 1 0000000000000000 20 4 30 10 -1\n")
+
+	tests := []struct {
+		name      string
+		file      string
+		inode     uint64
+		ip        string
+		remPort   int
+		localPort int
+		wantErr   bool
+	}{
+		{"ipv4 established", "1/net/tcp", 1002, "192.168.0.2", 54321, 22, false},
+		{"ipv4 listening", "1/net/tcp", 1001, "", 0, 0, true},
+		{"time wait has no inode", "1/net/tcp", 0, "", 0, 0, true},
+		{"missing inode", "1/net/tcp", 9999, "", 0, 0, true},
+		{"ipv4-mapped ipv6", "1/net/tcp6", 2002, "192.168.0.4", 57344, 22, false},
+		{"ipv6", "1/net/tcp6", 2003, "2001:db8::5", 40000, 2222, false},
+		{"ipv6 listening", "1/net/tcp6", 2001, "", 0, 0, true},
+		{"missing file", "2/net/tcp", 1002, "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, remPort, localPort, err := parseTCPFile(fsys, tt.file, tt.inode)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s:%d, want error", ip, remPort)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ip != tt.ip || remPort != tt.remPort || localPort != tt.localPort {
+				t.Fatalf("got %s:%d -> %d, want %s:%d -> %d", ip, remPort, localPort, tt.ip, tt.remPort, tt.localPort)
+			}
+		})
+	}
+}
+
+func TestHexToIP(t *testing.T) {
+	tests := map[string]string{
+		"0100007F":                         "127.0.0.1",
+		"00000000000000000000000001000000": "::1",
+		"0000000000000000FFFF00000100007F": "127.0.0.1",
+		"B80D0120000000000000000005000000": "2001:db8::5",
+	}
+	for in, want := range tests {
+		got, err := hexToIP(in)
+		if err != nil || got.String() != want {
+			t.Errorf("hexToIP(%s) = %v, %v; want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0100007", "0100007G", "01000000000000000000000000000000FF"} {
+		if _, err := hexToIP(in); err == nil {
+			t.Errorf("hexToIP(%q) succeeded", in)
+		}
+	}
+}
+
+func TestAcceptNetns(t *testing.T) {
+	lg, err := logger.NewLogger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := procfstest.New()
+	fsys.AddLink("100/ns/net", "net:[4026531840]")
+	fsys.AddLink("200/ns/net", "net:[4026532000]")
+
+	m := &Monitor{logger: lg, proc: fsys}
+	for i := 0; i < netnsChecks; i++ {
+		if got := m.acceptNetns(&AcceptEvent{Tgid: 100, Netns: 4026531840}); got != 4026531840 {
+			t.Fatalf("check %d: got %d", i, got)
+		}
+	}
+	// Once trusted, the kernel value is used even without /proc.
+	if got := m.acceptNetns(&AcceptEvent{Tgid: 300, Netns: 4026532100}); got != 4026532100 {
+		t.Fatalf("trusted: got %d", got)
+	}
+
+	m = &Monitor{logger: lg, proc: fsys}
+	if got := m.acceptNetns(&AcceptEvent{Tgid: 300, Netns: 4026532100}); got != 4026532100 {
+		t.Fatalf("process gone: got %d", got)
+	}
+	if got := m.acceptNetns(&AcceptEvent{Tgid: 200, Netns: 12345}); got != 4026532000 {
+		t.Fatalf("mismatch: got %d", got)
+	}
+	if got := m.acceptNetns(&AcceptEvent{Tgid: 100, Netns: 12345}); got != 4026531840 {
+		t.Fatalf("after mismatch: got %d", got)
+	}
+	if got := m.acceptNetns(&AcceptEvent{Tgid: 100}); got != 4026531840 {
+		t.Fatalf("tracepoint event: got %d", got)
+	}
+}
+
+func TestExecProbesFired(t *testing.T) {
+	m := &Monitor{health: health.NewTracker()}
+	m.execProbesFired(&ExecEvent{Tgid: 10, SessionRoot: 10, Kind: ExecKindExec})
+	m.execProbesFired(&ExecEvent{Tgid: 11, SessionRoot: 10, Kind: ExecKindExec})
+	m.execProbesFired(&ExecEvent{Tgid: 11, SessionRoot: 10, Kind: ExecKindExit})
+
+	probes := m.health.Report().Probes
+	for probe, want := range map[string]uint64{
+		"sys_enter_execve":   2,
+		"sched_process_exec": 2,
+		"sched_process_fork": 2,
+		"sched_process_exit": 1,
+	} {
+		if got := probes[probe].Events; got != want {
+			t.Errorf("%s fired %d times, want %d", probe, got, want)
+		}
+	}
+}
+
+func TestAcceptKeySpreads(t *testing.T) {
+	const workers = 4
+	shards := make(map[uint32]bool)
+	for port := uint16(40000); port < 40016; port++ {
+		ev := &AcceptEvent{Tgid: 1, HasSockInfo: 1, PeerIP: 0x0a000001, PeerPort: port, Fd: -1}
+		shards[acceptKey(ev)%workers] = true
+	}
+	if len(shards) != workers {
+		t.Fatalf("connections from one listener used %d of %d shards", len(shards), workers)
+	}
+}
+
+func TestSnapshotProc(t *testing.T) {
+	fsys := procfstest.New()
+	fsys.AddFile("42/stat", "42 (sh) S 41 42 41 34816 42 4194304 0 0 0 0")
+	fsys.AddLink("42/cwd", "/home/alice")
+	fsys.AddLink("42/ns/net", "net:[4026531840]")
+	m := &Monitor{proc: fsys}
+
+	pc := m.snapshotProc(&ExecEvent{Tgid: 42, Kind: ExecKindExec})
+	if pc != (procContext{cwd: "/home/alice", ppid: 41, netns: 4026531840}) {
+		t.Fatalf("exec: %+v", pc)
+	}
+	if pc := m.snapshotProc(&ExecEvent{Tgid: 42, Kind: ExecKindExit}); pc.cwd != "" || pc.ppid != 0 {
+		t.Fatalf("exit: %+v", pc)
+	}
+	if pc := m.snapshotProc(&ExecEvent{Tgid: 43, Kind: ExecKindExec}); pc != (procContext{}) {
+		t.Fatalf("gone: %+v", pc)
+	}
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// ObjectPath maps "secrds.bpf.o" to "secrds.<GOARCH>.bpf.o" when the
+// per-architecture build exists next to it, and keeps the name otherwise
+// so single-architecture builds still load.
+func ObjectPath(path string) string {
+	base, ok := strings.CutSuffix(path, ".bpf.o")
+	if !ok {
+		return path
+	}
+	archPath := base + "." + runtime.GOARCH + ".bpf.o"
+	if _, err := os.Stat(archPath); err == nil {
+		return archPath
+	}
+	return path
+}
+
+// checkObject rejects objects compiled for the other byte order, which
+// the kernel would otherwise accept with garbled instructions.
+func checkObject(spec *ebpf.CollectionSpec, path string) error {
+	if spec.ByteOrder == nil {
+		return nil
+	}
+	objLittle := spec.ByteOrder.Uint16([]byte{1, 0}) == 1
+	if objLittle != littleEndian {
+		return fmt.Errorf("%s is built for %s hosts, this is %s", path, endianName(objLittle), endianName(littleEndian))
+	}
+	return nil
+}
+
+func endianName(little bool) string {
+	if little {
+		return "little-endian"
+	}
+	return "big-endian"
+}
+
+// networkToHost32 and networkToHost16 convert fields the probes copy in
+// network byte order, such as inet_sock addresses and ports.
+func networkToHost32(v uint32) uint32 {
+	if littleEndian {
+		return swap32(v)
+	}
+	return v
+}
+
+func networkToHost16(v uint16) uint16 {
+	if littleEndian {
+		return swap16(v)
+	}
+	return v
+}
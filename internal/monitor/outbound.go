@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/cilium/ebpf/perf"
+
+	"secrds/internal/alert"
+	"secrds/internal/logger"
+)
+
+type ConnectEvent struct {
+	Header      EventHeader
+	Pid         uint32
+	Tgid        uint32
+	Uid         uint32
+	SessionRoot uint32
+	TsNs        uint64
+	CgroupID    uint64
+	Comm        [16]byte
+	Family      uint16
+	DPort       uint16
+	SPort       uint16
+	DAddr       [16]byte
+	SAddr       [16]byte
+	Kind        uint8
+	_           [1]byte
+}
+
+const (
+	ConnectKindConnect uint8 = iota
+	ConnectKindListen
+)
+
+const (
+	afInet  = 2
+	afInet6 = 10
+)
+
+func (ev *ConnectEvent) Destination() netip.Addr {
+	return eventAddr(ev.Family, ev.DAddr)
+}
+
+func (ev *ConnectEvent) Source() netip.Addr {
+	return eventAddr(ev.Family, ev.SAddr)
+}
+
+func eventAddr(family uint16, raw [16]byte) netip.Addr {
+	switch family {
+	case afInet:
+		return netip.AddrFrom4([4]byte{raw[0], raw[1], raw[2], raw[3]})
+	case afInet6:
+		return netip.AddrFrom16(raw).Unmap()
+	}
+	return netip.Addr{}
+}
+
+func (m *Monitor) StartConnectPerfReader() error {
+	if m.execCollection == nil {
+		return fmt.Errorf("exec BPF collection not loaded")
+	}
+
+	eventsMap := m.execCollection.Maps["connect_events"]
+	if eventsMap == nil {
+		return fmt.Errorf("failed to find connect_events map")
+	}
+
+	rd, err := perf.NewReader(eventsMap, 8*os.Getpagesize())
+	if err != nil {
+		return fmt.Errorf("failed to create connect perf reader: %w", err)
+	}
+
+	m.connectReader = rd
+	return nil
+}
+
+func (m *Monitor) ProcessConnectEvents() {
+	m.consume(m.connectReader, "connect", func(raw []byte) (uint32, func(), error) {
+		ev, err := DecodeConnectEvent(raw)
+		if err != nil {
+			return 0, nil, err
+		}
+		m.health.ProbeFired("inet_sock_set_state")
+		// Read the namespace now; the process may be gone by the time a
+		// worker handles the event.
+		netns := m.netnsOf(ev.Tgid)
+		return ev.SessionRoot, func() { m.handleConnectEvent(ev, netns) }, nil
+	})
+}
+
+func (m *Monitor) handleConnectEvent(ev *ConnectEvent, netns uint64) {
+	comm := strings.TrimRight(string(ev.Comm[:]), "\x00")
+	dest := ev.Destination()
+	destPort := int(ev.DPort)
+
+	var source netip.Addr
+	fields := []logger.Field{
+		logger.F("pid", ev.Tgid),
+		logger.F("comm", comm),
+		logger.F("uid", ev.Uid),
+		logger.F("user", usernameForUID(ev.Uid)),
+		logger.F("session_root", ev.SessionRoot),
+	}
+	if s := m.sessions.get(ev.SessionRoot); s != nil {
+		source, _ = netip.ParseAddr(s.RemoteHost)
+		fields = append([]logger.Field{logger.F("session", s.ID), logger.F("session_user", s.User), logger.F("rhost", s.RemoteHost)}, fields...)
+	}
+	fields = append(fields, m.eventFields(ev.CgroupID, ev.Tgid, netns)...)
+
+	if isSSHDComm(comm) {
+		m.handleTunnelEvent(ev, source, fields)
+		return
+	}
+
+	if ev.Kind == ConnectKindListen {
+		local := netip.AddrPortFrom(ev.Source(), ev.SPort).String()
+		m.logger.LogInfoFields(fields, "Listening socket opened by session process on %s", local)
+		return
+	}
+
+	dst := netip.AddrPortFrom(dest, uint16(destPort)).String()
+	m.logger.LogInfoFields(fields, "Outbound connection from session process to %s", dst)
+
+	cfg := m.config()
+	for i := range cfg.Outbound {
+		policy := &cfg.Outbound[i]
+		if !policy.Matches(source, dest, destPort) {
+			continue
+		}
+		m.alerts.Raise(alert.Alert{
+			Type:     "outbound_policy_violation",
+			Severity: alert.SeverityCritical,
+			Message:  fmt.Sprintf("policy %s: session process (pid %d) connected to %s", policy.Name, ev.Tgid, dst),
+			Fields:   append([]logger.Field{logger.F("policy", policy.Name), logger.F("destination", dst)}, fields...),
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/logger"
+	"secrds/internal/window"
+)
+
+type PrivEscEvent struct {
+	Service    string
+	Pid        uint32
+	Uid        uint32
+	User       string
+	TargetUser string
+	TTY        string
+	Session    uint32
+	Success    bool
+	RetCode    int32
+}
+
+func (m *Monitor) handlePrivEscEvent(ev *AuthEvent, fields []logger.Field) {
+	pev := &PrivEscEvent{
+		Service: ev.PAMService(),
+		Pid:     ev.Tgid,
+		Uid:     ev.Uid,
+		User:    usernameForUID(ev.Uid),
+		TTY:     strings.TrimRight(string(ev.TTY[:]), "\x00"),
+		Session: findSSHSession(m.proc, ev.Tgid),
+		Success: ev.RetCode == 0,
+		RetCode: ev.RetCode,
+	}
+	pev.TargetUser = targetUser(pev.Service, strings.TrimRight(string(ev.User[:]), "\x00"), readCmdline(m.proc, ev.Tgid))
+
+	result := "failure"
+	if pev.Success {
+		result = "success"
+	}
+
+	fields = append([]logger.Field{
+		logger.F("uid", pev.Uid),
+		logger.F("user", pev.User),
+		logger.F("target_user", pev.TargetUser),
+		logger.F("tty", pev.TTY),
+		logger.F("ssh_session", m.sessionLabel(pev.Session)),
+		logger.F("result", result),
+	}, fields...)
+
+	m.logger.LogInfoFields(fields, "Privilege escalation attempt via %s (PID: %d, PAM return code: %d)",
+		pev.Service, pev.Pid, pev.RetCode)
+
+	policy := m.config().PrivEsc
+	if pev.Success || policy.MaxFailures == 0 {
+		return
+	}
+
+	key := strconv.FormatUint(uint64(pev.Uid), 10)
+	count := m.privEscFailures(policy.Window.Duration).Add(key, time.Now())
+	if count != policy.MaxFailures {
+		return
+	}
+
+	m.alerts.Raise(alert.Alert{
+		Type:     "privilege_escalation_failures",
+		Severity: alert.SeverityCritical,
+		Message: fmt.Sprintf("%s (uid %d) failed %d %s attempts within %s",
+			pev.User, pev.Uid, count, pev.Service, policy.Window.Duration),
+		Fields: fields,
+	})
+}
+
+func (m *Monitor) privEscFailures(span time.Duration) *window.Counter {
+	m.serviceMutex.Lock()
+	defer m.serviceMutex.Unlock()
+
+	if m.privEscCounter == nil {
+		m.privEscCounter = window.NewCounter(span)
+	}
+	return m.privEscCounter
+}
+
+func targetUser(service string, pamUser string, argv []string) string {
+	switch service {
+	case "sudo":
+		for i := 1; i < len(argv); i++ {
+			arg := argv[i]
+			switch {
+			case arg == "-u" || arg == "--user":
+				if i+1 < len(argv) {
+					return argv[i+1]
+				}
+			case strings.HasPrefix(arg, "--user="):
+				return strings.TrimPrefix(arg, "--user=")
+			case strings.HasPrefix(arg, "-u") && len(arg) > 2:
+				return arg[2:]
+			case arg == "--" || !strings.HasPrefix(arg, "-"):
+				return "root"
+			}
+		}
+		return "root"
+	case "su":
+		if pamUser != "" {
+			return pamUser
+		}
+		for _, arg := range argv[min(1, len(argv)):] {
+			if arg != "-" && !strings.HasPrefix(arg, "-") {
+				return arg
+			}
+		}
+		return "root"
+	}
+	return pamUser
+}
+
+func usernameForUID(uid uint32) string {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return strconv.FormatUint(uint64(uid), 10)
+	}
+	return u.Username
+}
+
+func (m *Monitor) sessionLabel(session uint32) string {
+	if session == 0 {
+		return "none"
+	}
+	if s := m.sessionFor(session); s != nil {
+		return s.ID
+	}
+	return strconv.FormatUint(uint64(session), 10)
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"secrds/internal/procfs"
+)
+
+type procStat struct {
+	Pid  uint32
+	Comm string
+	PPid uint32
+	TTY  uint32
+}
+
+func readProcStat(fsys procfs.FS, pid uint32) (*procStat, error) {
+	data, err := fsys.ReadFile(procfs.PidPath(pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	open := bytes.IndexByte(data, '(')
+	close := bytes.LastIndexByte(data, ')')
+	if open < 0 || close < open {
+		return nil, fmt.Errorf("malformed stat for PID %d", pid)
+	}
+
+	fields := strings.Fields(string(data[close+1:]))
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("short stat for PID %d", pid)
+	}
+
+	ppid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ppid for PID %d", pid)
+	}
+	tty, _ := strconv.ParseUint(fields[4], 10, 32)
+
+	return &procStat{
+		Pid:  pid,
+		Comm: string(data[open+1 : close]),
+		PPid: uint32(ppid),
+		TTY:  uint32(tty),
+	}, nil
+}
+
+func readCmdline(fsys procfs.FS, pid uint32) []string {
+	data, err := fsys.ReadFile(procfs.PidPath(pid, "cmdline"))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+}
+
+func isSSHDComm(comm string) bool {
+	return comm == "sshd" || comm == "sshd-session"
+}
+
+func findSSHSession(fsys procfs.FS, pid uint32) uint32 {
+	for depth := 0; pid > 1 && depth < 64; depth++ {
+		st, err := readProcStat(fsys, pid)
+		if err != nil {
+			return 0
+		}
+		if isSSHDComm(st.Comm) {
+			return st.Pid
+		}
+		pid = st.PPid
+	}
+	return 0
+}
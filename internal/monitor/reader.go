@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf/perf"
+)
+
+// Readers wake up at least this often so a wedged reader goroutine shows
+// up as a stale heartbeat even when no events arrive.
+const readerPollInterval = time.Second
+
+func (m *Monitor) StalledReaders(maxAge time.Duration) []string {
+	return m.health.Stalled(maxAge)
+}
+
+// consume reads records from rd on the calling goroutine and hands the
+// decoded work to the pool; records decode rejects are counted and dropped.
+func (m *Monitor) consume(rd *perf.Reader, label string, decode func(raw []byte) (key uint32, run func(), err error)) {
+	m.wg.Add(1)
+	defer m.wg.Done()
+
+	if rd == nil {
+		return
+	}
+
+	for {
+		if atomic.LoadInt32(&m.shuttingDown) != 0 || m.ctx.Err() != nil {
+			return
+		}
+
+		rd.SetDeadline(time.Now().Add(readerPollInterval))
+		record, err := rd.Read()
+		m.health.Heartbeat(label)
+		if err != nil {
+			if atomic.LoadInt32(&m.shuttingDown) != 0 || m.ctx.Err() != nil || err == perf.ErrClosed {
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			m.health.ReadError(label)
+			m.logger.LogError("Error reading %s perf event: %v", label, err)
+			continue
+		}
+
+		if record.LostSamples > 0 {
+			m.health.Lost(label, record.LostSamples)
+			m.logger.LogError("Lost %d %s samples", record.LostSamples, label)
+			continue
+		}
+
+		decodeStart := time.Now()
+		key, run, err := decode(record.RawSample)
+		if err != nil {
+			m.health.DecodeFailure(label, decodeReason(err))
+			continue
+		}
+		m.health.Received(label)
+		m.pool.RecordDecode(label, time.Since(decodeStart))
+		m.pool.Submit(label, key, run)
+	}
+}
+
+// disabledPoll is how often a periodic task whose interval is 0 looks for
+// a reload that enables it.
+const disabledPoll = 5 * time.Second
+
+// every calls fn each interval() until the monitor stops. The interval is
+// read before each wait, so reloads take effect after the current one, and
+// fn is skipped while it is 0.
+func (m *Monitor) every(interval func() time.Duration, fn func()) {
+	m.wg.Add(1)
+	defer m.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for {
+		wait := interval()
+		enabled := wait > 0
+		if !enabled {
+			wait = disabledPoll
+		}
+		timer.Reset(wait)
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if enabled && interval() > 0 {
+			fn()
+		}
+	}
+}
+
+// ReportPipelineStats logs queue depth and per-stage latency every
+// pipeline.stats_interval.
+func (m *Monitor) ReportPipelineStats() {
+	m.every(func() time.Duration { return m.config().Pipeline.StatsInterval.Duration }, m.logPipelineStats)
+}
+
+func (m *Monitor) logPipelineStats() {
+	stats := m.pool.Stats()
+	m.logger.LogInfo("Pipeline: depth=%d/%d workers=%d overflow=%s",
+		stats.Depth, stats.Capacity, stats.Workers, stats.Policy)
+	for _, st := range stats.Stages {
+		m.logger.LogInfo("Pipeline stage %s: submitted=%d handled=%d dropped=%d decode_avg=%s decode_max=%s wait_avg=%s wait_max=%s run_avg=%s run_max=%s",
+			st.Stage, st.Submitted, st.Handled, st.Dropped,
+			st.DecodeAvg, st.DecodeMax, st.WaitAvg, st.WaitMax, st.RunAvg, st.RunMax)
+	}
+}
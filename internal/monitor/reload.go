@@ -0,0 +1,36 @@
+package monitor
+
+import "secrds/internal/config"
+
+func (m *Monitor) config() *config.Config {
+	return m.cfg.Load()
+}
+
+// ApplyConfig swaps in a validated config. Handlers pick it up on their
+// next event; rate windows whose span changed start over.
+func (m *Monitor) ApplyConfig(cfg *config.Config) {
+	old := m.cfg.Swap(cfg)
+
+	m.serviceMutex.Lock()
+	defer m.serviceMutex.Unlock()
+
+	for name := range m.serviceCounters {
+		svc := findService(cfg, name)
+		prev := findService(old, name)
+		if svc == nil || prev == nil || svc.Policy.Window != prev.Policy.Window {
+			delete(m.serviceCounters, name)
+		}
+	}
+	if cfg.PrivEsc.Window != old.PrivEsc.Window {
+		m.privEscCounter = nil
+	}
+}
+
+func findService(cfg *config.Config, name string) *config.Service {
+	for i := range cfg.Services {
+		if cfg.Services[i].Name == name {
+			return &cfg.Services[i]
+		}
+	}
+	return nil
+}
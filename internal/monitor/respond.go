@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+	"net/netip"
+
+	"secrds/internal/config"
+	"secrds/internal/geoip"
+	"secrds/internal/logger"
+	"secrds/internal/threatintel"
+)
+
+// blocked runs the policies that can ban addr and reports whether its
+// connection must be cut, either because a policy just banned it or
+// because it was banned before.
+func (m *Monitor) blocked(stage string, covers func(*config.GeoFence) bool, addr netip.Addr, info geoip.Info, matches []threatintel.Match, fields []logger.Field) bool {
+	banned := m.geoFence(stage, covers, addr, info, fields)
+	banned = m.feedBan(addr, matches, fields) || banned
+	_, listed := m.response.Banned(addr)
+	return banned || listed
+}
+
+// feedBan bans addr when a feed configured to ban lists it with a high
+// enough score. Lists such as FireHOL level 1 include the private ranges,
+// which are never banned.
+func (m *Monitor) feedBan(addr netip.Addr, matches []threatintel.Match, fields []logger.Field) bool {
+	if m.response == nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, match := range matches {
+		if match.Ban {
+			m.response.Ban(addr, "feed "+match.Feed,
+				fmt.Sprintf("listed in %s as %s with score %g", match.Feed, match.Prefix, match.Score),
+				match.BanDuration, fields...)
+			return true
+		}
+	}
+	return false
+}
+
+// cutConnection resets an accepted connection before the client gets to
+// authenticate.
+func (m *Monitor) cutConnection(tgid uint32, local, remote netip.AddrPort, fields []logger.Field) {
+	if !local.IsValid() {
+		m.logger.LogError("Cannot reset connection from %s: local address unknown", remote)
+		return
+	}
+	if err := m.response.DropConnection(tgid, local, remote); err != nil {
+		m.logger.LogError("Cannot reset connection from %s: %v", remote, err)
+		return
+	}
+	m.logger.LogInfoFields(fields, "Reset connection from banned address %s", remote.Addr())
+}
+
+// cutLogin ends a login in progress by terminating the process that serves
+// the connection. Only forked per-connection processes are terminated,
+// never the listening daemon.
+func (m *Monitor) cutLogin(tgid uint32, addr netip.Addr, fields []logger.Field) {
+	err := m.response.Terminate(tgid, func() error {
+		st, err := readProcStat(m.proc, tgid)
+		if err != nil {
+			return err
+		}
+		parent, err := readProcStat(m.proc, st.PPid)
+		if err != nil || st.PPid <= 1 || !(parent.Comm == st.Comm || isSSHDComm(parent.Comm) && isSSHDComm(st.Comm)) {
+			return fmt.Errorf("PID %d does not serve a single connection", tgid)
+		}
+		return nil
+	})
+	if err != nil {
+		m.logger.LogError("Cannot end login from %s: %v", addr, err)
+		return
+	}
+	m.logger.LogInfoFields(fields, "Terminated PID %d serving banned address %s", tgid, addr)
+}
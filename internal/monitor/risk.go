@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/config"
+	"secrds/internal/logger"
+	"secrds/internal/risk"
+	"secrds/internal/threatintel"
+)
+
+// riskSweepInterval is how often pending connections are checked for
+// pre-auth disconnects.
+const riskSweepInterval = 10 * time.Second
+
+// scoreConnection feeds an accepted service connection to the risk engine
+// and reports whether the address was banned for it.
+func (m *Monitor) scoreConnection(svc *config.Service, addr netip.Addr, country string, matches []threatintel.Match, fields []logger.Field) bool {
+	preauth := slices.Contains(m.config().Risk.PreAuthServices, svc.Name)
+	banned := m.riskBand(m.risk.Connection(addr, country, preauth), fields)
+	if score := feedScore(matches); score > 0 {
+		banned = m.riskBand(m.risk.ThreatFeed(addr, score), fields) || banned
+	}
+	return banned
+}
+
+// riskBand raises a risk_band alert when ch entered a band and bans the
+// address if the band asks for it. It reports whether it banned.
+func (m *Monitor) riskBand(ch risk.Change, fields []logger.Field) bool {
+	if ch.Entered == nil {
+		return false
+	}
+	band, s := ch.Entered, ch.Score
+	m.alerts.Raise(alert.Alert{
+		Type:     "risk_band",
+		Severity: band.Severity,
+		Message:  fmt.Sprintf("%s entered risk band %s with score %.1f", s.Addr, band.Name, s.Score),
+		Fields: append([]logger.Field{
+			logger.F("ip", s.Addr),
+			logger.F("band", band.Name),
+			logger.F("score", s.Score),
+			logger.F("breakdown", s.Summary()),
+			logger.F("action", band.Action),
+		}, fields...),
+	})
+
+	if band.Action != config.ActionBan || m.response == nil || s.Addr.IsLoopback() {
+		return false
+	}
+	m.response.Ban(s.Addr, "risk "+band.Name,
+		fmt.Sprintf("risk score %.1f reached band %s (%s)", s.Score, band.Name, s.Summary()),
+		band.BanDuration.Duration, fields...)
+	return true
+}
+
+func feedScore(matches []threatintel.Match) float64 {
+	var score float64
+	for _, match := range matches {
+		score = max(score, match.Score)
+	}
+	return score
+}
+
+// WatchRisk periodically turns connections that never reached PAM into
+// pre-auth disconnects and acts on the bands they push scores into.
+func (m *Monitor) WatchRisk() {
+	if m.risk == nil {
+		return
+	}
+	m.wg.Add(1)
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(riskSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, ch := range m.risk.Sweep() {
+			m.riskBand(ch, nil)
+		}
+	}
+}
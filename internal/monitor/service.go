@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/config"
+	"secrds/internal/logger"
+	"secrds/internal/window"
+)
+
+func (m *Monitor) netnsName(netns uint64) string {
+	if ns := m.config().Namespace(netns); ns != nil {
+		return ns.Name
+	}
+	return ""
+}
+
+func (m *Monitor) serviceCounter(svc *config.Service) *window.Counter {
+	m.serviceMutex.Lock()
+	defer m.serviceMutex.Unlock()
+
+	counter, ok := m.serviceCounters[svc.Name]
+	if !ok {
+		counter = window.NewCounter(svc.Policy.Window.Duration)
+		m.serviceCounters[svc.Name] = counter
+	}
+	return counter
+}
+
+func (m *Monitor) recordServiceConnection(svc *config.Service, ip string, netns uint64, fields []logger.Field) {
+	policy := svc.Policy
+	if policy.MaxConnections == 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%d/%s", netns, ip)
+	count := m.serviceCounter(svc).Add(key, time.Now())
+	if count != policy.MaxConnections {
+		return
+	}
+
+	m.alerts.Raise(alert.Alert{
+		Type:     "service_connection_rate",
+		Severity: alert.SeverityWarning,
+		Message: fmt.Sprintf("%s: %d connections from %s within %s",
+			svc.Name, count, ip, policy.Window.Duration),
+		Fields: append([]logger.Field{logger.F("service", svc.Name), logger.F("ip", ip)}, fields...),
+	})
+}
@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"secrds/internal/logger"
+)
+
+type Session struct {
+	ID         string
+	Service    string
+	User       string
+	RemoteHost string
+	TTY        string
+	Tgid       uint32
+	AuthMethod string
+	AcctResult string
+	Opened     time.Time
+	Tunnels    []Tunnel
+}
+
+type Tunnel struct {
+	Kind     string
+	Endpoint string
+	Opened   time.Time
+}
+
+type pendingAuth struct {
+	pamAuthenticated bool
+	acctResult       string
+	seen             time.Time
+}
+
+type sessionTable struct {
+	mu       sync.RWMutex
+	sessions map[uint32]*Session
+	pending  map[uint32]*pendingAuth
+	pruned   time.Time
+}
+
+const pendingAuthTTL = 10 * time.Minute
+
+func newSessionTable() *sessionTable {
+	return &sessionTable{
+		sessions: make(map[uint32]*Session),
+		pending:  make(map[uint32]*pendingAuth),
+	}
+}
+
+// pendingFor returns the PAM state of a login in progress. Logins that
+// never open a session, such as every attempt of a brute force, are pruned
+// here once they are older than pendingAuthTTL.
+func (t *sessionTable) pendingFor(tgid uint32) *pendingAuth {
+	now := time.Now()
+	if now.Sub(t.pruned) > pendingAuthTTL/10 {
+		for id, p := range t.pending {
+			if now.Sub(p.seen) > pendingAuthTTL {
+				delete(t.pending, id)
+			}
+		}
+		t.pruned = now
+	}
+
+	p, ok := t.pending[tgid]
+	if !ok {
+		p = &pendingAuth{}
+		t.pending[tgid] = p
+	}
+	p.seen = now
+	return p
+}
+
+func (t *sessionTable) recordAuth(tgid uint32, success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pendingFor(tgid).pamAuthenticated = success
+}
+
+func (t *sessionTable) recordAcct(tgid uint32, result string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pendingFor(tgid).acctResult = result
+}
+
+func (t *sessionTable) open(s *Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if p, ok := t.pending[s.Tgid]; ok {
+		if p.pamAuthenticated {
+			s.AuthMethod = "pam"
+		}
+		s.AcctResult = p.acctResult
+		delete(t.pending, s.Tgid)
+	}
+	if s.AuthMethod == "" {
+		s.AuthMethod = "external"
+	}
+
+	t.sessions[s.Tgid] = s
+}
+
+func (t *sessionTable) close(tgid uint32) *Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[tgid]
+	if !ok {
+		return nil
+	}
+	delete(t.sessions, tgid)
+	return s
+}
+
+func (t *sessionTable) addTunnel(tgid uint32, tunnel Tunnel) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[tgid]
+	if !ok {
+		return 0
+	}
+	s.Tunnels = append(s.Tunnels, tunnel)
+	return len(s.Tunnels)
+}
+
+func (t *sessionTable) get(tgid uint32) *Session {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sessions[tgid]
+}
+
+func (m *Monitor) sessionFor(pid uint32) *Session {
+	for depth := 0; pid > 1 && depth < 64; depth++ {
+		if s := m.sessions.get(pid); s != nil {
+			return s
+		}
+		st, err := readProcStat(m.proc, pid)
+		if err != nil {
+			return nil
+		}
+		pid = st.PPid
+	}
+	return nil
+}
+
+func pamResult(retCode int32) string {
+	if retCode == 0 {
+		return "success"
+	}
+	return fmt.Sprintf("failure(%d)", retCode)
+}
+
+func (m *Monitor) handleSessionEvent(ev *AuthEvent, service string, netns uint64) {
+	user := strings.TrimRight(string(ev.User[:]), "\x00")
+	rhost := strings.TrimRight(string(ev.RHost[:]), "\x00")
+	fields := append([]logger.Field{logger.F("pam_service", service)}, m.eventFields(ev.CgroupID, ev.Tgid, netns)...)
+
+	switch ev.Kind {
+	case AuthKindAcctMgmt:
+		// Public key logins skip pam_authenticate; this is the first
+		// PAM activity for their connection.
+		if addr, err := netip.ParseAddr(rhost); err == nil {
+			m.risk.AuthActivity(addr)
+		}
+		m.sessions.recordAcct(ev.Tgid, pamResult(ev.RetCode))
+		m.logger.LogInfoFields(fields, "Account check for %s from %s: %s (PID: %d)",
+			user, rhost, pamResult(ev.RetCode), ev.Tgid)
+
+	case AuthKindOpenSession:
+		if ev.RetCode != 0 {
+			m.logger.LogInfoFields(fields, "Session open for %s from %s failed: %s (PID: %d)",
+				user, rhost, pamResult(ev.RetCode), ev.Tgid)
+			return
+		}
+
+		s := &Session{
+			ID:         fmt.Sprintf("%d-%x", ev.Tgid, ev.TsNs),
+			Service:    service,
+			User:       user,
+			RemoteHost: rhost,
+			TTY:        strings.TrimRight(string(ev.TTY[:]), "\x00"),
+			Tgid:       ev.Tgid,
+			Opened:     time.Now(),
+		}
+		m.sessions.open(s)
+		m.trackSession(s.Tgid)
+		if addr, err := netip.ParseAddr(rhost); err == nil {
+			m.risk.Success(addr, m.geo.Lookup(addr).CountryCode)
+		}
+
+		fields = append([]logger.Field{
+			logger.F("session", s.ID),
+			logger.F("user", s.User),
+			logger.F("rhost", s.RemoteHost),
+			logger.F("tty", s.TTY),
+			logger.F("auth", s.AuthMethod),
+			logger.F("acct", s.AcctResult),
+		}, fields...)
+		m.logger.LogInfoFields(fields, "Session opened for %s from %s (PID: %d)", s.User, s.RemoteHost, s.Tgid)
+
+	case AuthKindCloseSession:
+		s := m.sessions.close(ev.Tgid)
+		m.untrackSession(ev.Tgid)
+		if s == nil {
+			m.logger.LogInfoFields(fields, "Session closed for %s from %s (PID: %d, not tracked)", user, rhost, ev.Tgid)
+			return
+		}
+
+		fields = append([]logger.Field{
+			logger.F("session", s.ID),
+			logger.F("user", s.User),
+			logger.F("rhost", s.RemoteHost),
+			logger.F("duration", time.Since(s.Opened).Round(time.Second)),
+			logger.F("tunnels", tunnelSummary(s.Tunnels)),
+		}, fields...)
+		m.logger.LogInfoFields(fields, "Session closed for %s from %s (PID: %d)", s.User, s.RemoteHost, s.Tgid)
+	}
+}
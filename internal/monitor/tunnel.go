@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/logger"
+)
+
+const (
+	tunnelRemote = "remote"
+	tunnelLocal  = "local"
+)
+
+func (m *Monitor) handleTunnelEvent(ev *ConnectEvent, source netip.Addr, fields []logger.Field) {
+	tunnel := Tunnel{Opened: time.Now()}
+	if ev.Kind == ConnectKindListen {
+		tunnel.Kind = tunnelRemote
+		tunnel.Endpoint = netip.AddrPortFrom(ev.Source(), ev.SPort).String()
+	} else {
+		tunnel.Kind = tunnelLocal
+		tunnel.Endpoint = netip.AddrPortFrom(ev.Destination(), ev.DPort).String()
+	}
+
+	count := m.sessions.addTunnel(ev.SessionRoot, tunnel)
+	fields = append([]logger.Field{
+		logger.F("tunnel", tunnel.Kind),
+		logger.F("endpoint", tunnel.Endpoint),
+		logger.F("session_tunnels", count),
+	}, fields...)
+	m.logger.LogInfoFields(fields, "SSH %s forward detected: %s", tunnel.Kind, tunnel.Endpoint)
+
+	user := ""
+	if s := m.sessions.get(ev.SessionRoot); s != nil {
+		user = s.User
+	}
+	if reason := m.config().Forwarding.Violation(user, source); reason != "" {
+		m.alerts.Raise(alert.Alert{
+			Type:     "forbidden_port_forwarding",
+			Severity: alert.SeverityCritical,
+			Message:  fmt.Sprintf("%s forward to %s: %s", tunnel.Kind, tunnel.Endpoint, reason),
+			Fields:   fields,
+		})
+	}
+}
+
+func tunnelSummary(tunnels []Tunnel) string {
+	if len(tunnels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(tunnels))
+	for _, t := range tunnels {
+		parts = append(parts, t.Kind+":"+t.Endpoint)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,79 @@
+package pamlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	ldCacheOldMagic = "ld.so-1.7.0"
+	ldCacheNewMagic = "glibc-ld.so.cache1.1"
+
+	ldCacheOldEntrySize = 12
+	ldCacheNewHeaderLen = 48
+	ldCacheNewEntrySize = 24
+)
+
+// LDCacheLookup returns every path the ld.so cache at cachePath records
+// for the library soname, covering all architectures present.
+func LDCacheLookup(cachePath, soname string) ([]string, error) {
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseLDCache(data, soname)
+}
+
+// parseLDCache understands the glibc 2.32+ format and the older combined
+// file that prefixes it with a libc5-era table.
+func parseLDCache(data []byte, soname string) ([]string, error) {
+	if bytes.HasPrefix(data, []byte(ldCacheOldMagic)) {
+		if len(data) < 16 {
+			return nil, fmt.Errorf("truncated ld.so cache")
+		}
+		n := binary.LittleEndian.Uint32(data[12:16])
+		start := 16 + int(n)*ldCacheOldEntrySize
+		start = (start + 7) &^ 7
+		if start > len(data) {
+			return nil, fmt.Errorf("truncated ld.so cache")
+		}
+		data = data[start:]
+	}
+	if !bytes.HasPrefix(data, []byte(ldCacheNewMagic)) {
+		return nil, fmt.Errorf("unrecognized ld.so cache format")
+	}
+	if len(data) < ldCacheNewHeaderLen {
+		return nil, fmt.Errorf("truncated ld.so cache")
+	}
+
+	n := int(binary.LittleEndian.Uint32(data[20:24]))
+	if ldCacheNewHeaderLen+n*ldCacheNewEntrySize > len(data) {
+		return nil, fmt.Errorf("ld.so cache claims %d entries, file is %d bytes", n, len(data))
+	}
+
+	var paths []string
+	for i := 0; i < n; i++ {
+		e := data[ldCacheNewHeaderLen+i*ldCacheNewEntrySize:]
+		key := cString(data, binary.LittleEndian.Uint32(e[4:8]))
+		if key != soname {
+			continue
+		}
+		if value := cString(data, binary.LittleEndian.Uint32(e[8:12])); value != "" {
+			paths = append(paths, value)
+		}
+	}
+	return paths, nil
+}
+
+func cString(data []byte, off uint32) string {
+	if int(off) >= len(data) {
+		return ""
+	}
+	s := data[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
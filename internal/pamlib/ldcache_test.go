@@ -0,0 +1,84 @@
+package pamlib
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newLDCache builds a glibc-ld.so.cache1.1 table mapping each soname in
+// entries (pairs of soname and path) to its path.
+func newLDCache(entries ...string) []byte {
+	n := len(entries) / 2
+	strOff := ldCacheNewHeaderLen + n*ldCacheNewEntrySize
+	buf := make([]byte, strOff)
+	copy(buf, ldCacheNewMagic)
+	binary.LittleEndian.PutUint32(buf[20:24], uint32(n))
+	for i := 0; i < n; i++ {
+		e := buf[ldCacheNewHeaderLen+i*ldCacheNewEntrySize:]
+		binary.LittleEndian.PutUint32(e[4:8], uint32(len(buf)))
+		buf = append(append(buf, entries[2*i]...), 0)
+		binary.LittleEndian.PutUint32(e[8:12], uint32(len(buf)))
+		buf = append(append(buf, entries[2*i+1]...), 0)
+	}
+	return buf
+}
+
+// withOldTable prefixes cache with an ld.so-1.7.0 table of n entries.
+func withOldTable(cache []byte, n int) []byte {
+	old := make([]byte, 16+n*ldCacheOldEntrySize)
+	copy(old, ldCacheOldMagic)
+	binary.LittleEndian.PutUint32(old[12:16], uint32(n))
+	for len(old)%8 != 0 {
+		old = append(old, 0)
+	}
+	return append(old, cache...)
+}
+
+func TestParseLDCache(t *testing.T) {
+	cache := newLDCache(
+		"libc.so.6", "/lib/x86_64-linux-gnu/libc.so.6",
+		Soname, "/lib/x86_64-linux-gnu/libpam.so.0",
+		Soname, "/lib/i386-linux-gnu/libpam.so.0",
+	)
+	tooMany := newLDCache(Soname, "/lib/libpam.so.0")
+	binary.LittleEndian.PutUint32(tooMany[20:24], 1000)
+	badOffset := newLDCache(Soname, "/lib/libpam.so.0")
+	binary.LittleEndian.PutUint32(badOffset[ldCacheNewHeaderLen+8:], 1<<20)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr string
+	}{
+		{"new format", cache, []string{"/lib/x86_64-linux-gnu/libpam.so.0", "/lib/i386-linux-gnu/libpam.so.0"}, ""},
+		{"combined format", withOldTable(cache, 3), []string{"/lib/x86_64-linux-gnu/libpam.so.0", "/lib/i386-linux-gnu/libpam.so.0"}, ""},
+		{"not listed", newLDCache("libc.so.6", "/lib/libc.so.6"), nil, ""},
+		{"empty", nil, nil, "unrecognized"},
+		{"unknown magic", []byte("ld.so-2.0.0 and some more bytes here"), nil, "unrecognized"},
+		{"truncated header", cache[:ldCacheNewHeaderLen-1], nil, "truncated"},
+		{"truncated old table", []byte(ldCacheOldMagic), nil, "truncated"},
+		{"old table past end", withOldTable(nil, 4)[:20], nil, "truncated"},
+		{"entries past end", tooMany, nil, "claims 1000 entries"},
+		{"string past end", badOffset, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLDCache(tt.data, Soname)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package pamlib
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"secrds/internal/procfs"
+)
+
+const Soname = "libpam.so.0"
+
+const (
+	SourceMaps    = "maps"
+	SourceDeleted = "deleted mapping"
+	SourceLDCache = "ld.so.cache"
+	SourcePath    = "search path"
+)
+
+// deletedSuffix marks a mapping whose file was removed or replaced, as an
+// upgrade does with the library of a long-running daemon.
+const deletedSuffix = " (deleted)"
+
+// Functions are the libpam entry points secrds probes.
+var Functions = []string{"pam_authenticate", "pam_acct_mgmt", "pam_open_session", "pam_close_session"}
+
+var searchDirs = []string{
+	"/lib/x86_64-linux-gnu",
+	"/usr/lib/x86_64-linux-gnu",
+	"/lib/aarch64-linux-gnu",
+	"/usr/lib/aarch64-linux-gnu",
+	"/lib/riscv64-linux-gnu",
+	"/usr/lib/riscv64-linux-gnu",
+	"/lib/s390x-linux-gnu",
+	"/usr/lib/s390x-linux-gnu",
+	"/lib64",
+	"/usr/lib64",
+	"/lib",
+	"/usr/lib",
+	"/run/current-system/sw/lib",
+}
+
+var nixGlob = "/nix/store/*-linux-pam-*/lib/" + Soname
+
+type Library struct {
+	Path   string
+	Source string
+	Pid    uint32
+}
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// Discover lists the distinct libpam builds on the host, most relevant
+// first: the ones mapped by running processes whose comm is in comms
+// (reached through /proc/<pid>/root so containerized daemons are covered,
+// or /proc/<pid>/map_files when the mapped file has been deleted),
+// then what the ld.so cache knows, then well-known multiarch and NixOS
+// locations. Files are deduplicated by device and inode.
+func Discover(fsys procfs.FS, comms []string) []Library {
+	seen := make(map[fileID]bool)
+	var libs []Library
+
+	add := func(lib Library) {
+		st, err := os.Stat(lib.Path)
+		if err != nil || !st.Mode().IsRegular() {
+			return
+		}
+		sys, ok := st.Sys().(*syscall.Stat_t)
+		if !ok {
+			return
+		}
+		id := fileID{uint64(sys.Dev), sys.Ino}
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		libs = append(libs, lib)
+	}
+
+	for _, lib := range mappedLibraries(fsys, comms) {
+		add(lib)
+	}
+
+	if paths, err := LDCacheLookup("/etc/ld.so.cache", Soname); err == nil {
+		for _, p := range paths {
+			add(Library{Path: p, Source: SourceLDCache})
+		}
+	}
+
+	for _, dir := range searchDirs {
+		add(Library{Path: filepath.Join(dir, Soname), Source: SourcePath})
+	}
+	if matches, err := filepath.Glob(nixGlob); err == nil {
+		for _, p := range matches {
+			add(Library{Path: p, Source: SourcePath})
+		}
+	}
+	return libs
+}
+
+func mappedLibraries(fsys procfs.FS, comms []string) []Library {
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+
+	want := make(map[string]bool, len(comms))
+	for _, c := range comms {
+		want[c] = true
+	}
+
+	var libs []Library
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		comm, err := fsys.ReadFile(procfs.PidPath(uint32(pid), "comm"))
+		if err != nil || !want[strings.TrimSpace(string(comm))] {
+			continue
+		}
+		maps, err := fsys.ReadFile(procfs.PidPath(uint32(pid), "maps"))
+		if err != nil {
+			continue
+		}
+		for _, mp := range libpamMappings(maps) {
+			lib := Library{
+				Path:   hostPath(uint32(pid), mp.path),
+				Source: SourceMaps,
+				Pid:    uint32(pid),
+			}
+			if mp.deleted {
+				// The file is gone from the filesystem, but map_files
+				// still opens the inode the process has mapped.
+				lib.Path = filepath.Join("/proc", strconv.FormatUint(pid, 10), "map_files", mp.addrs)
+				lib.Source = SourceDeleted
+			}
+			libs = append(libs, lib)
+		}
+	}
+	return libs
+}
+
+type mapping struct {
+	path    string
+	addrs   string // start-end as named in /proc/<pid>/map_files
+	deleted bool
+}
+
+// libpamMappings returns the distinct libpam files in a maps file, each
+// with the address range of its first mapping.
+func libpamMappings(maps []byte) []mapping {
+	var out []mapping
+	// A replaced library can be mapped both deleted and from its new file.
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(maps))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		name := strings.Join(fields[5:], " ")
+		p, deleted := strings.CutSuffix(name, deletedSuffix)
+		if !strings.HasPrefix(path.Base(p), "libpam.so") || seen[name] {
+			continue
+		}
+		addrs, ok := mapFilesName(fields[0])
+		if !ok {
+			continue
+		}
+		seen[name] = true
+		out = append(out, mapping{path: p, addrs: addrs, deleted: deleted})
+	}
+	return out
+}
+
+// mapFilesName turns a maps address range, which is zero-padded, into the
+// unpadded name map_files uses for it.
+func mapFilesName(r string) (string, bool) {
+	start, end, ok := strings.Cut(r, "-")
+	if !ok {
+		return "", false
+	}
+	s, err := strconv.ParseUint(start, 16, 64)
+	if err != nil {
+		return "", false
+	}
+	e, err := strconv.ParseUint(end, 16, 64)
+	if err != nil {
+		return "", false
+	}
+	return strconv.FormatUint(s, 16) + "-" + strconv.FormatUint(e, 16), true
+}
+
+// hostPath prefers the plain path when it names the same file the process
+// sees, and otherwise goes through the process's root.
+func hostPath(pid uint32, p string) string {
+	rooted := filepath.Join("/proc", strconv.FormatUint(uint64(pid), 10), "root", p)
+	host, err := os.Stat(p)
+	if err != nil {
+		return rooted
+	}
+	inProc, err := os.Stat(rooted)
+	if err != nil || os.SameFile(host, inProc) {
+		return p
+	}
+	return rooted
+}
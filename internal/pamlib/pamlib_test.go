@@ -0,0 +1,57 @@
+package pamlib
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLibpamMappings(t *testing.T) {
+	tests := []struct {
+		name string
+		maps string
+		want []mapping
+	}{
+		{
+			name: "host library mapped several times",
+			maps: "7f2a10000000-7f2a10003000 r--p 00000000 fe:00 1234 /usr/lib/x86_64-linux-gnu/libpam.so.0.85.1\n" +
+				"7f2a10003000-7f2a1000c000 r-xp 00003000 fe:00 1234 /usr/lib/x86_64-linux-gnu/libpam.so.0.85.1\n" +
+				"7f2a20000000-7f2a20001000 r--p 00000000 fe:00 99 /usr/lib/x86_64-linux-gnu/libpam_misc.so.0\n" +
+				"7f2a30000000-7f2a30001000 r--p 00000000 fe:00 98 /usr/lib/x86_64-linux-gnu/libc.so.6\n",
+			want: []mapping{{path: "/usr/lib/x86_64-linux-gnu/libpam.so.0.85.1", addrs: "7f2a10000000-7f2a10003000"}},
+		},
+		{
+			name: "deleted after an upgrade",
+			maps: "00400000-00401000 r--p 00000000 fe:00 1234 /lib64/libpam.so.0 (deleted)\n" +
+				"00401000-00409000 r-xp 00001000 fe:00 1234 /lib64/libpam.so.0 (deleted)\n",
+			want: []mapping{{path: "/lib64/libpam.so.0", addrs: "400000-401000", deleted: true}},
+		},
+		{
+			name: "path with spaces",
+			maps: "7f0000000000-7f0000001000 r--p 00000000 fe:00 7 /opt/my libs/libpam.so.0\n",
+			want: []mapping{{path: "/opt/my libs/libpam.so.0", addrs: "7f0000000000-7f0000001000"}},
+		},
+		{
+			name: "old and new copy",
+			maps: "1000-2000 r--p 00000000 fe:00 1 /lib/libpam.so.0 (deleted)\n" +
+				"3000-4000 r--p 00000000 fe:00 2 /lib/libpam.so.0\n",
+			want: []mapping{
+				{path: "/lib/libpam.so.0", addrs: "1000-2000", deleted: true},
+				{path: "/lib/libpam.so.0", addrs: "3000-4000"},
+			},
+		},
+		{
+			name: "anonymous and malformed lines",
+			maps: "7ffd00000000-7ffd00021000 rw-p 00000000 00:00 0 [stack]\n" +
+				"7f0000000000-7f0000001000 rw-p 00000000 00:00 0\n" +
+				"zzzz-7f0000001000 r--p 00000000 fe:00 7 /lib/libpam.so.0\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := libpamMappings([]byte(tt.maps)); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
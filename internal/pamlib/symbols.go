@@ -0,0 +1,78 @@
+package pamlib
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+var ErrWrongArch = errors.New("library is built for another architecture")
+
+var machines = map[string]elf.Machine{
+	"amd64":   elf.EM_X86_64,
+	"arm64":   elf.EM_AARCH64,
+	"riscv64": elf.EM_RISCV,
+	"s390x":   elf.EM_S390,
+	"386":     elf.EM_386,
+	"arm":     elf.EM_ARM,
+}
+
+// Symbols maps exported function names to the file offsets uprobes attach at.
+type Symbols map[string]uint64
+
+// ReadSymbols reads the dynamic symbol table of the library at path and
+// translates each wanted function's virtual address into a file offset
+// through the PT_LOAD segment that contains it.
+func ReadSymbols(path string, wanted ...string) (Symbols, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if m, ok := machines[runtime.GOARCH]; ok && f.Machine != m {
+		return nil, fmt.Errorf("%s: %w (%s)", path, ErrWrongArch, f.Machine)
+	}
+
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dynamic symbols of %s: %w", path, err)
+	}
+
+	want := make(map[string]bool, len(wanted))
+	for _, name := range wanted {
+		want[name] = true
+	}
+
+	found := make(Symbols)
+	for _, sym := range syms {
+		if !want[sym.Name] || elf.ST_TYPE(sym.Info) != elf.STT_FUNC {
+			continue
+		}
+		if sym.Section == elf.SHN_UNDEF || sym.Value == 0 {
+			continue
+		}
+		off, ok := fileOffset(f, sym.Value)
+		if !ok {
+			continue
+		}
+		// Versioned duplicates of a symbol keep the first definition.
+		if _, dup := found[sym.Name]; !dup {
+			found[sym.Name] = off
+		}
+	}
+	return found, nil
+}
+
+func fileOffset(f *elf.File, vaddr uint64) (uint64, bool) {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || p.Flags&elf.PF_X == 0 {
+			continue
+		}
+		if vaddr >= p.Vaddr && vaddr < p.Vaddr+p.Memsz {
+			return vaddr - p.Vaddr + p.Off, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,258 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+		return p, nil
+	case "":
+		return OverflowDropOldest, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q", s)
+}
+
+type job struct {
+	stage    string
+	enqueued time.Time
+	run      func()
+}
+
+type Pool struct {
+	shards []chan job
+	policy OverflowPolicy
+	wg     sync.WaitGroup
+	closed int32
+	// sending is held for reading while a job is sent to a shard and for
+	// writing while Stop closes them, so a late SubmitAfter timer cannot
+	// send on a closed channel.
+	sending sync.RWMutex
+
+	mu     sync.Mutex
+	stages map[string]*stageStats
+}
+
+type stageStats struct {
+	submitted   uint64
+	dropped     uint64
+	handled     uint64
+	decoded     uint64
+	decodeTotal time.Duration
+	decodeMax   time.Duration
+	waitTotal   time.Duration
+	waitMax     time.Duration
+	runTotal    time.Duration
+	runMax      time.Duration
+}
+
+type StageStats struct {
+	Stage     string
+	Submitted uint64
+	Dropped   uint64
+	Handled   uint64
+	DecodeAvg time.Duration
+	DecodeMax time.Duration
+	WaitAvg   time.Duration
+	WaitMax   time.Duration
+	RunAvg    time.Duration
+	RunMax    time.Duration
+}
+
+type Stats struct {
+	Depth    int
+	Capacity int
+	Workers  int
+	Policy   OverflowPolicy
+	Stages   []StageStats
+}
+
+func New(queueSize, workers int, policy OverflowPolicy) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	perShard := queueSize / workers
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	p := &Pool{
+		shards: make([]chan job, workers),
+		policy: policy,
+		stages: make(map[string]*stageStats),
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan job, perShard)
+	}
+	return p
+}
+
+func (p *Pool) Start() {
+	for _, shard := range p.shards {
+		p.wg.Add(1)
+		go p.work(shard)
+	}
+}
+
+func (p *Pool) Stop() {
+	p.sending.Lock()
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		p.sending.Unlock()
+		return
+	}
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.sending.Unlock()
+	p.wg.Wait()
+}
+
+// Submit queues fn on the shard chosen by key, so jobs with the same key
+// (such as a tgid) run in submission order.
+func (p *Pool) Submit(stage string, key uint32, fn func()) bool {
+	p.sending.RLock()
+	defer p.sending.RUnlock()
+	if atomic.LoadInt32(&p.closed) != 0 {
+		return false
+	}
+
+	st := p.stage(stage)
+	j := job{stage: stage, enqueued: time.Now(), run: fn}
+	shard := p.shards[int(key)%len(p.shards)]
+
+	p.mu.Lock()
+	st.submitted++
+	p.mu.Unlock()
+
+	select {
+	case shard <- j:
+		return true
+	default:
+	}
+
+	switch p.policy {
+	case OverflowBlock:
+		shard <- j
+		return true
+	case OverflowDropOldest:
+		select {
+		case old := <-shard:
+			p.countDrop(old.stage)
+		default:
+		}
+		select {
+		case shard <- j:
+			return true
+		default:
+		}
+	}
+
+	p.countDrop(stage)
+	return false
+}
+
+// SubmitAfter submits fn once delay has passed. Handlers use it to retry
+// a lookup later instead of sleeping on their worker, which would hold up
+// every other job on the shard.
+func (p *Pool) SubmitAfter(stage string, key uint32, delay time.Duration, fn func()) {
+	time.AfterFunc(delay, func() { p.Submit(stage, key, fn) })
+}
+
+func (p *Pool) work(shard chan job) {
+	defer p.wg.Done()
+
+	for j := range shard {
+		start := time.Now()
+		j.run()
+		elapsed := time.Since(start)
+		wait := start.Sub(j.enqueued)
+
+		p.mu.Lock()
+		st := p.stages[j.stage]
+		st.handled++
+		st.waitTotal += wait
+		st.runTotal += elapsed
+		if wait > st.waitMax {
+			st.waitMax = wait
+		}
+		if elapsed > st.runMax {
+			st.runMax = elapsed
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *Pool) stage(name string) *stageStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.stages[name]
+	if !ok {
+		st = &stageStats{}
+		p.stages[name] = st
+	}
+	return st
+}
+
+func (p *Pool) RecordDecode(stage string, d time.Duration) {
+	st := p.stage(stage)
+
+	p.mu.Lock()
+	st.decoded++
+	st.decodeTotal += d
+	if d > st.decodeMax {
+		st.decodeMax = d
+	}
+	p.mu.Unlock()
+}
+
+func (p *Pool) countDrop(stage string) {
+	p.mu.Lock()
+	p.stages[stage].dropped++
+	p.mu.Unlock()
+}
+
+func (p *Pool) Stats() Stats {
+	s := Stats{Workers: len(p.shards), Policy: p.policy}
+	for _, shard := range p.shards {
+		s.Depth += len(shard)
+		s.Capacity += cap(shard)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, st := range p.stages {
+		ss := StageStats{
+			Stage:     name,
+			Submitted: st.submitted,
+			Dropped:   st.dropped,
+			Handled:   st.handled,
+			DecodeMax: st.decodeMax,
+			WaitMax:   st.waitMax,
+			RunMax:    st.runMax,
+		}
+		if st.decoded > 0 {
+			ss.DecodeAvg = st.decodeTotal / time.Duration(st.decoded)
+		}
+		if st.handled > 0 {
+			ss.WaitAvg = st.waitTotal / time.Duration(st.handled)
+			ss.RunAvg = st.runTotal / time.Duration(st.handled)
+		}
+		s.Stages = append(s.Stages, ss)
+	}
+	sort.Slice(s.Stages, func(i, j int) bool { return s.Stages[i].Stage < s.Stages[j].Stage })
+	return s
+}
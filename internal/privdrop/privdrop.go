@@ -0,0 +1,163 @@
+package privdrop
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrNeedsStaticBinary is returned when the per-thread parts of the drop
+// (capabilities, no_new_privs, landlock) cannot be applied to every thread.
+// syscall.AllThreadsSyscall only works in binaries built with CGO_ENABLED=0.
+var ErrNeedsStaticBinary = errors.New("privilege dropping requires a binary built with CGO_ENABLED=0")
+
+type Options struct {
+	User         string
+	Group        string
+	Capabilities []string
+	Landlock     bool
+	ReadPaths    []string
+	WritePaths   []string
+	Seccomp      bool
+}
+
+type Result struct {
+	Uid          int
+	Gid          int
+	Capabilities []string
+	Landlock     int
+	Seccomp      bool
+}
+
+// Drop switches the whole process to opts.User, keeping only
+// opts.Capabilities, then optionally confines the filesystem view with
+// landlock and installs the seccomp denylist. It is meant to run once,
+// after every BPF program is loaded and attached.
+func Drop(opts Options) (*Result, error) {
+	if opts.User == "" {
+		return nil, fmt.Errorf("no user configured")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	uid, gid, err := lookupIDs(opts.User, opts.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	keep, err := ParseCapabilities(opts.Capabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	var ruleset int = -1
+	abi := 0
+	if opts.Landlock {
+		ruleset, abi, err = landlockRuleset(opts.ReadPaths, opts.WritePaths)
+		if err != nil {
+			return nil, err
+		}
+		defer unix.Close(ruleset)
+	}
+
+	if err := allThreads(unix.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 1, 0); err != nil {
+		return nil, fmt.Errorf("failed to set keepcaps: %w", err)
+	}
+	if err := dropBoundingSet(keep); err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return nil, fmt.Errorf("failed to set groups: %w", err)
+	}
+	if err := syscall.Setresgid(gid, gid, gid); err != nil {
+		return nil, fmt.Errorf("failed to set gid %d: %w", gid, err)
+	}
+	if err := syscall.Setresuid(uid, uid, uid); err != nil {
+		return nil, fmt.Errorf("failed to set uid %d: %w", uid, err)
+	}
+
+	if err := setCapabilities(keep); err != nil {
+		return nil, err
+	}
+	if err := allThreads(unix.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 0, 0); err != nil {
+		return nil, fmt.Errorf("failed to clear keepcaps: %w", err)
+	}
+	if err := allThreads(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0); err != nil {
+		return nil, fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	if ruleset >= 0 {
+		if err := allThreads(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); err != nil {
+			return nil, fmt.Errorf("failed to apply landlock ruleset: %w", err)
+		}
+	}
+
+	if opts.Seccomp {
+		if err := installSeccomp(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{
+		Uid:          uid,
+		Gid:          gid,
+		Capabilities: CapabilityNames(keep),
+		Landlock:     abi,
+		Seccomp:      opts.Seccomp,
+	}, nil
+}
+
+func lookupIDs(userName, groupName string) (int, int, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to look up user %q: %w", userName, err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("user %q has non-numeric uid %q", userName, u.Uid)
+	}
+	gidStr := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to look up group %q: %w", groupName, err)
+		}
+		gidStr = g.Gid
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("non-numeric gid %q", gidStr)
+	}
+	if uid == 0 {
+		return 0, 0, fmt.Errorf("user %q is root", userName)
+	}
+	return uid, gid, nil
+}
+
+func allThreads(trap, a1, a2, a3 uintptr) error {
+	_, _, errno := syscall.AllThreadsSyscall(trap, a1, a2, a3)
+	if errno == syscall.ENOTSUP {
+		return ErrNeedsStaticBinary
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// DefaultReadPaths are what the resolvers read after the drop: procfs,
+// the cgroup tree, container runtime metadata and /etc for users and config.
+var DefaultReadPaths = []string{
+	"/proc",
+	"/sys/fs/cgroup",
+	"/etc",
+	"/var/lib/docker/containers",
+	"/var/lib/containers/storage",
+}
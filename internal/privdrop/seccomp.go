@@ -0,0 +1,110 @@
+package privdrop
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// deniedSyscalls fail with EPERM once the filter is installed. None of
+// them is needed after startup, and each is a common next step for code
+// that has taken over the process.
+var deniedSyscalls = []uintptr{
+	unix.SYS_EXECVE,
+	unix.SYS_EXECVEAT,
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_MOUNT,
+	unix.SYS_UMOUNT2,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_CHROOT,
+	unix.SYS_UNSHARE,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_REBOOT,
+	unix.SYS_SWAPON,
+	unix.SYS_SWAPOFF,
+	unix.SYS_KEYCTL,
+	unix.SYS_ADD_KEY,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_USERFAULTFD,
+}
+
+var auditArch = map[string]uint32{
+	"amd64":   unix.AUDIT_ARCH_X86_64,
+	"arm64":   unix.AUDIT_ARCH_AARCH64,
+	"riscv64": unix.AUDIT_ARCH_RISCV64,
+	"s390x":   unix.AUDIT_ARCH_S390X,
+}
+
+func seccompFilter() ([]unix.SockFilter, error) {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("seccomp filter is not supported on %s", runtime.GOARCH)
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jeq := func(k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: jt, Jf: jf, K: k}
+	}
+
+	n := len(deniedSyscalls)
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataArch),
+		jeq(arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataNr),
+	}
+	// x32 syscalls share the x86_64 audit arch; reject them outright.
+	if runtime.GOARCH == "amd64" {
+		prog = append(prog,
+			unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: uint8(n + 2), K: 0x40000000},
+		)
+	}
+	for i, nr := range deniedSyscalls {
+		prog = append(prog, jeq(uint32(nr), uint8(n-i), 0))
+	}
+	prog = append(prog,
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetAllow),
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetErrno|uint32(unix.EPERM)),
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+	)
+	return prog, nil
+}
+
+// installSeccomp applies the filter to every thread through TSYNC;
+// no_new_privs must already be set on the calling thread.
+func installSeccomp() error {
+	filter, err := seccompFilter()
+	if err != nil {
+		return err
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	tid, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return fmt.Errorf("failed to install seccomp filter: %w", errno)
+	}
+	if tid != 0 {
+		return fmt.Errorf("failed to install seccomp filter: thread %d could not be synchronized", tid)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package procfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FS is a read-only view of a procfs mount. Names are slash-separated and
+// relative to the mount root, e.g. "1234/net/tcp".
+type FS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	Readlink(name string) (string, error)
+}
+
+func PidPath(pid uint32, elem ...string) string {
+	return path.Join(append([]string{fmt.Sprint(pid)}, elem...)...)
+}
+
+type hostFS struct {
+	root string
+	fs.FS
+}
+
+func Host() FS {
+	return New("/proc")
+}
+
+func New(root string) FS {
+	return &hostFS{root: root, FS: os.DirFS(root)}
+}
+
+func (h *hostFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(h.FS, name)
+}
+
+func (h *hostFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(h.FS, name)
+}
+
+func (h *hostFS) Readlink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(h.root, filepath.FromSlash(name)))
+}
@@ -0,0 +1,42 @@
+// Package procfstest provides an in-memory procfs.FS for tests.
+package procfstest
+
+import (
+	"io/fs"
+	"testing/fstest"
+
+	"secrds/internal/procfs"
+)
+
+var _ procfs.FS = (*Fixture)(nil)
+
+// Fixture is an in-memory procfs for tests. Files live in MapFS and
+// symlinks such as fd/N, cwd or ns/net are listed in Links by name.
+type Fixture struct {
+	fstest.MapFS
+	Links map[string]string
+}
+
+func New() *Fixture {
+	return &Fixture{
+		MapFS: fstest.MapFS{},
+		Links: make(map[string]string),
+	}
+}
+
+func (f *Fixture) AddFile(name string, data string) {
+	f.MapFS[name] = &fstest.MapFile{Data: []byte(data), Mode: 0444}
+}
+
+func (f *Fixture) AddLink(name string, target string) {
+	f.Links[name] = target
+	f.MapFS[name] = &fstest.MapFile{Mode: fs.ModeSymlink | 0777}
+}
+
+func (f *Fixture) Readlink(name string) (string, error) {
+	target, ok := f.Links[name]
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	return target, nil
+}
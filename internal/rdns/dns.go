@@ -0,0 +1,426 @@
+package rdns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	typeA     = 1
+	typeCNAME = 5
+	typePTR   = 12
+	typeAAAA  = 28
+	classIN   = 1
+
+	rcodeNXDomain = 3
+
+	headerLen = 12
+	udpMaxLen = 4096
+	maxLabels = 128
+)
+
+var (
+	ErrNotFound  = errors.New("no such record")
+	errMalformed = errors.New("malformed DNS message")
+)
+
+// Client is a minimal DNS stub resolver that, unlike net.Resolver, reports
+// record TTLs. It asks Servers in order over UDP and retries over TCP when
+// an answer is truncated.
+type Client struct {
+	Servers []string
+}
+
+// SystemServers reads the nameservers from /etc/resolv.conf.
+func SystemServers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	var servers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		addr, err := netip.ParseAddr(strings.SplitN(fields[1], "%", 2)[0])
+		if err != nil {
+			continue
+		}
+		servers = append(servers, netip.AddrPortFrom(addr, 53).String())
+	}
+	return servers
+}
+
+func (c *Client) LookupPTR(ctx context.Context, addr netip.Addr) ([]string, time.Duration, error) {
+	name := reverseName(addr)
+	records, err := c.query(ctx, name, typePTR)
+	if err != nil {
+		return nil, 0, err
+	}
+	var names []string
+	ttl := time.Duration(-1)
+	// The owner may be an RFC 2317 alias such as 1.0/25.2.0.192.in-addr.arpa,
+	// so only the PTR target has to be a hostname.
+	for _, rr := range followCNAMEs(records, name) {
+		if rr.typ == typePTR && hostname(rr.name) {
+			names = append(names, rr.name)
+			ttl = minTTL(ttl, rr.ttl)
+		}
+	}
+	if len(names) == 0 {
+		return nil, 0, ErrNotFound
+	}
+	return names, ttl, nil
+}
+
+func (c *Client) LookupAddrs(ctx context.Context, name string) ([]netip.Addr, time.Duration, error) {
+	var addrs []netip.Addr
+	ttl := time.Duration(-1)
+	var lastErr error
+	for _, qtype := range []uint16{typeA, typeAAAA} {
+		records, err := c.query(ctx, name, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range followCNAMEs(records, name) {
+			if rr.typ == qtype {
+				addrs = append(addrs, rr.addr)
+				ttl = minTTL(ttl, rr.ttl)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		if lastErr == nil || errors.Is(lastErr, ErrNotFound) {
+			return nil, 0, ErrNotFound
+		}
+		return nil, 0, lastErr
+	}
+	return addrs, ttl, nil
+}
+
+func minTTL(cur, ttl time.Duration) time.Duration {
+	if cur < 0 || ttl < cur {
+		return ttl
+	}
+	return cur
+}
+
+// followCNAMEs keeps the records owned by name or by a name it is an
+// alias of, so unrelated additional data cannot confirm anything.
+func followCNAMEs(records []record, name string) []record {
+	owners := map[string]bool{canonical(name): true}
+	for changed := true; changed; {
+		changed = false
+		for _, rr := range records {
+			if rr.typ == typeCNAME && owners[rr.owner] && !owners[rr.name] {
+				owners[rr.name] = true
+				changed = true
+			}
+		}
+	}
+	var out []record
+	for _, rr := range records {
+		if owners[rr.owner] {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+func reverseName(addr netip.Addr) string {
+	addr = addr.Unmap()
+	var b strings.Builder
+	if addr.Is4() {
+		a := addr.As4()
+		fmt.Fprintf(&b, "%d.%d.%d.%d.in-addr.arpa.", a[3], a[2], a[1], a[0])
+		return b.String()
+	}
+	a := addr.As16()
+	const hex = "0123456789abcdef"
+	for i := len(a) - 1; i >= 0; i-- {
+		b.WriteByte(hex[a[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[a[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+func canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+type record struct {
+	owner string
+	typ   uint16
+	ttl   time.Duration
+	name  string // PTR and CNAME target
+	addr  netip.Addr
+}
+
+func (c *Client) query(ctx context.Context, name string, qtype uint16) ([]record, error) {
+	if len(c.Servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers configured")
+	}
+	var lastErr error
+	for _, server := range c.Servers {
+		records, err := c.exchange(ctx, server, name, qtype)
+		if err == nil || errors.Is(err, ErrNotFound) {
+			return records, err
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *Client) exchange(ctx context.Context, server, name string, qtype uint16) ([]record, error) {
+	var idBuf [2]byte
+	if _, err := rand.Read(idBuf[:]); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idBuf[:])
+	msg, err := buildQuery(id, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := exchangeUDP(ctx, server, msg, id)
+	if err != nil {
+		return nil, err
+	}
+	records, truncated, err := parseResponse(resp, id)
+	if truncated {
+		if resp, err = exchangeTCP(ctx, server, msg); err != nil {
+			return nil, err
+		}
+		records, _, err = parseResponse(resp, id)
+	}
+	return records, err
+}
+
+func exchangeUDP(ctx context.Context, server string, msg []byte, id uint16) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, udpMaxLen)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams that do not answer this query.
+		if n >= headerLen && binary.BigEndian.Uint16(buf[0:2]) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+func exchangeTCP(ctx context.Context, server string, msg []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	if _, err := conn.Write(append(framed, msg...)); err != nil {
+		return nil, err
+	}
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func buildQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(msg[0:2], id)
+	binary.BigEndian.PutUint16(msg[2:4], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:6], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, classIN)
+	return msg, nil
+}
+
+// parseResponse returns the answer records of msg and whether it was
+// truncated. NXDOMAIN yields ErrNotFound.
+func parseResponse(msg []byte, id uint16) ([]record, bool, error) {
+	if len(msg) < headerLen || binary.BigEndian.Uint16(msg[0:2]) != id {
+		return nil, false, errMalformed
+	}
+	flags := binary.BigEndian.Uint16(msg[2:4])
+	if flags&0x8000 == 0 {
+		return nil, false, errMalformed
+	}
+	truncated := flags&0x0200 != 0
+	switch rcode := flags & 0xf; rcode {
+	case 0:
+	case rcodeNXDomain:
+		return nil, truncated, ErrNotFound
+	default:
+		return nil, truncated, fmt.Errorf("DNS server returned rcode %d", rcode)
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:6]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:8]))
+	off := headerLen
+	for i := 0; i < qdcount; i++ {
+		_, next, err := readName(msg, off)
+		if err != nil {
+			return nil, truncated, err
+		}
+		off = next + 4
+	}
+
+	var records []record
+	for i := 0; i < ancount; i++ {
+		owner, next, err := readName(msg, off)
+		if err != nil {
+			return nil, truncated, err
+		}
+		if next+10 > len(msg) {
+			return nil, truncated, errMalformed
+		}
+		rr := record{
+			owner: owner,
+			typ:   binary.BigEndian.Uint16(msg[next : next+2]),
+			ttl:   time.Duration(binary.BigEndian.Uint32(msg[next+4:next+8])) * time.Second,
+		}
+		class := binary.BigEndian.Uint16(msg[next+2 : next+4])
+		rdlen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		rdata := next + 10
+		if rdata+rdlen > len(msg) {
+			return nil, truncated, errMalformed
+		}
+		off = rdata + rdlen
+		if class != classIN {
+			continue
+		}
+
+		switch rr.typ {
+		case typePTR, typeCNAME:
+			if rr.name, _, err = readName(msg, rdata); err != nil {
+				return nil, truncated, err
+			}
+		case typeA:
+			if rdlen != 4 {
+				return nil, truncated, errMalformed
+			}
+			rr.addr = netip.AddrFrom4([4]byte(msg[rdata : rdata+4]))
+		case typeAAAA:
+			if rdlen != 16 {
+				return nil, truncated, errMalformed
+			}
+			rr.addr = netip.AddrFrom16([16]byte(msg[rdata : rdata+16]))
+		default:
+			continue
+		}
+		records = append(records, rr)
+	}
+	return records, truncated, nil
+}
+
+// readName decodes a possibly compressed name at off and returns it in
+// canonical form with the offset after it.
+func readName(msg []byte, off int) (string, int, error) {
+	var b strings.Builder
+	end := -1
+	for labels := 0; ; labels++ {
+		if off >= len(msg) || labels > maxLabels {
+			return "", 0, errMalformed
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			if b.Len() == 0 {
+				return ".", end, nil
+			}
+			return strings.ToLower(b.String()), end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:off+2]) & 0x3fff)
+		case n&0xc0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errMalformed
+			}
+			b.Write(msg[off+1 : off+1+n])
+			b.WriteByte('.')
+			off += 1 + n
+		}
+	}
+}
+
+// hostname reports whether every label of name holds only letters, digits
+// and hyphens. PTR targets are chosen by whoever owns the reverse zone and
+// end up in logs and alerts, so nothing else is accepted from them.
+func hostname(name string) bool {
+	if name == "." {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			switch c := label[i]; {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
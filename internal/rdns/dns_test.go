@@ -0,0 +1,403 @@
+package rdns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+type answer struct {
+	owner string
+	typ   uint16
+	ttl   uint32
+	rdata []byte
+}
+
+func encName(name string) []byte {
+	msg, err := buildQuery(0, name, 0)
+	if err != nil {
+		panic(err)
+	}
+	return msg[headerLen : len(msg)-4]
+}
+
+func ptrAnswer(owner, target string, ttl uint32) answer {
+	return answer{owner, typePTR, ttl, encName(target)}
+}
+
+func cnameAnswer(owner, target string, ttl uint32) answer {
+	return answer{owner, typeCNAME, ttl, encName(target)}
+}
+
+func addrAnswer(owner string, addr netip.Addr, ttl uint32) answer {
+	typ := uint16(typeA)
+	if addr.Is6() {
+		typ = typeAAAA
+	}
+	return answer{owner, typ, ttl, addr.AsSlice()}
+}
+
+// reply builds a response to the question in query with flags added to QR.
+func reply(query []byte, flags uint16, answers ...answer) []byte {
+	_, end, err := readName(query, headerLen)
+	if err != nil {
+		panic(err)
+	}
+	msg := slices.Clone(query[:end+4])
+	binary.BigEndian.PutUint16(msg[2:4], 0x8000|flags)
+	binary.BigEndian.PutUint16(msg[6:8], uint16(len(answers)))
+	for _, a := range answers {
+		msg = append(msg, encName(a.owner)...)
+		msg = binary.BigEndian.AppendUint16(msg, a.typ)
+		msg = binary.BigEndian.AppendUint16(msg, classIN)
+		msg = binary.BigEndian.AppendUint32(msg, a.ttl)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(a.rdata)))
+		msg = append(msg, a.rdata...)
+	}
+	return msg
+}
+
+func mustQuery(t testing.TB, id uint16, name string, qtype uint16) []byte {
+	t.Helper()
+	msg, err := buildQuery(id, name, qtype)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// fakeServer answers on the same port over UDP and TCP. udp returns the
+// datagrams to send back in order; tcp, if set, answers TCP retries.
+type fakeServer struct {
+	addr string
+	udp  func(query []byte) [][]byte
+	tcp  func(query []byte) []byte
+}
+
+func newFakeServer(t *testing.T, udp func([]byte) [][]byte, tcp func([]byte) []byte) *fakeServer {
+	t.Helper()
+	s := &fakeServer{udp: udp, tcp: tcp}
+	var (
+		ln net.Listener
+		pc net.PacketConn
+	)
+	for i := 0; ; i++ {
+		var err error
+		if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if pc, err = net.ListenPacket("udp", ln.Addr().String()); err == nil {
+			break
+		}
+		ln.Close()
+		if i == 10 {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		pc.Close()
+	})
+	s.addr = ln.Addr().String()
+
+	go func() {
+		buf := make([]byte, udpMaxLen)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, resp := range s.udp(slices.Clone(buf[:n])) {
+				pc.WriteTo(resp, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var lenBuf [2]byte
+				if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+				if _, err := io.ReadFull(conn, query); err != nil || s.tcp == nil {
+					return
+				}
+				resp := s.tcp(query)
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) client() *Client {
+	return &Client{Servers: []string{s.addr}}
+}
+
+func TestParseResponse(t *testing.T) {
+	query := mustQuery(t, 7, "5.2.0.192.in-addr.arpa.", typePTR)
+	ptr := reply(query, 0, ptrAnswer("5.2.0.192.in-addr.arpa.", "Host.Example.", 300))
+
+	// Owner compressed to the question name at offset 12.
+	compressed := slices.Clone(query)
+	binary.BigEndian.PutUint16(compressed[2:4], 0x8000)
+	binary.BigEndian.PutUint16(compressed[6:8], 1)
+	compressed = append(compressed, 0xc0, headerLen)
+	compressed = binary.BigEndian.AppendUint16(compressed, typePTR)
+	compressed = binary.BigEndian.AppendUint16(compressed, classIN)
+	compressed = binary.BigEndian.AppendUint32(compressed, 60)
+	target := encName("host.example.")
+	compressed = binary.BigEndian.AppendUint16(compressed, uint16(len(target)))
+	compressed = append(compressed, target...)
+
+	// Owner is a pointer to itself.
+	loop := slices.Clone(query)
+	binary.BigEndian.PutUint16(loop[2:4], 0x8000)
+	binary.BigEndian.PutUint16(loop[6:8], 1)
+	loop = append(loop, 0xc0, byte(len(loop)))
+
+	truncatedFlag := reply(query, 0x0200)
+	wrongID := slices.Clone(ptr)
+	wrongID[1]++
+	notResponse := slices.Clone(ptr)
+	notResponse[2] &^= 0x80
+
+	for _, tc := range []struct {
+		name      string
+		msg       []byte
+		want      []record
+		truncated bool
+		err       error
+	}{
+		{
+			name: "ptr",
+			msg:  ptr,
+			want: []record{{owner: "5.2.0.192.in-addr.arpa.", typ: typePTR, ttl: 300 * time.Second, name: "host.example."}},
+		},
+		{
+			name: "compressed owner",
+			msg:  compressed,
+			want: []record{{owner: "5.2.0.192.in-addr.arpa.", typ: typePTR, ttl: time.Minute, name: "host.example."}},
+		},
+		{
+			name: "rfc 2317 alias",
+			msg: reply(query, 0,
+				cnameAnswer("5.2.0.192.in-addr.arpa.", "5.0/25.2.0.192.in-addr.arpa.", 300),
+				ptrAnswer("5.0/25.2.0.192.in-addr.arpa.", "host.example.", 300)),
+			want: []record{
+				{owner: "5.2.0.192.in-addr.arpa.", typ: typeCNAME, ttl: 300 * time.Second, name: "5.0/25.2.0.192.in-addr.arpa."},
+				{owner: "5.0/25.2.0.192.in-addr.arpa.", typ: typePTR, ttl: 300 * time.Second, name: "host.example."},
+			},
+		},
+		{
+			name: "addresses",
+			msg: reply(query, 0,
+				addrAnswer("host.example.", netip.MustParseAddr("192.0.2.5"), 10),
+				addrAnswer("host.example.", netip.MustParseAddr("2001:db8::5"), 20)),
+			want: []record{
+				{owner: "host.example.", typ: typeA, ttl: 10 * time.Second, addr: netip.MustParseAddr("192.0.2.5")},
+				{owner: "host.example.", typ: typeAAAA, ttl: 20 * time.Second, addr: netip.MustParseAddr("2001:db8::5")},
+			},
+		},
+		{name: "truncated flag", msg: truncatedFlag, truncated: true},
+		{name: "nxdomain", msg: reply(query, rcodeNXDomain), err: ErrNotFound},
+		{name: "pointer loop", msg: loop, err: errMalformed},
+		{name: "cut short", msg: ptr[:len(ptr)-3], err: errMalformed},
+		{name: "short header", msg: ptr[:headerLen-1], err: errMalformed},
+		{name: "id mismatch", msg: wrongID, err: errMalformed},
+		{name: "not a response", msg: notResponse, err: errMalformed},
+		{name: "bad address length", msg: reply(query, 0, answer{"host.example.", typeA, 10, []byte{1, 2, 3}}), err: errMalformed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, truncated, err := parseResponse(tc.msg, 7)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if truncated != tc.truncated {
+				t.Errorf("truncated = %v, want %v", truncated, tc.truncated)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("records = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHostname(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"host.example.", true},
+		{"mail-1.Example.", true},
+		{"host", true},
+		{".", false},
+		{"host..example.", false},
+		{"5.0/25.2.0.192.in-addr.arpa.", false},
+		{"host_1.example.", false},
+		{"evil\x1b[2J.example.", false},
+		{"sp ace.example.", false},
+	} {
+		if got := hostname(tc.name); got != tc.want {
+			t.Errorf("hostname(%q) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestClientLookupPTR(t *testing.T) {
+	addr := netip.MustParseAddr("192.0.2.5")
+	owner := reverseName(addr)
+
+	for _, tc := range []struct {
+		name    string
+		udp     func(query []byte) [][]byte
+		tcp     func(query []byte) []byte
+		want    []string
+		wantTTL time.Duration
+		err     error
+	}{
+		{
+			name: "answer",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, 0, ptrAnswer(owner, "host.example.", 300))}
+			},
+			want:    []string{"host.example."},
+			wantTTL: 300 * time.Second,
+		},
+		{
+			name: "stray reply ignored",
+			udp: func(q []byte) [][]byte {
+				stray := reply(q, 0, ptrAnswer(owner, "forged.example.", 300))
+				stray[1]++
+				return [][]byte{stray, reply(q, 0, ptrAnswer(owner, "host.example.", 300))}
+			},
+			want:    []string{"host.example."},
+			wantTTL: 300 * time.Second,
+		},
+		{
+			name: "truncated retried over tcp",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, 0x0200)}
+			},
+			tcp: func(q []byte) []byte {
+				return reply(q, 0,
+					ptrAnswer(owner, "a.example.", 300),
+					ptrAnswer(owner, "b.example.", 60))
+			},
+			want:    []string{"a.example.", "b.example."},
+			wantTTL: time.Minute,
+		},
+		{
+			name: "rfc 2317 alias",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, 0,
+					cnameAnswer(owner, "5.0/25.2.0.192.in-addr.arpa.", 300),
+					ptrAnswer("5.0/25.2.0.192.in-addr.arpa.", "host.example.", 120))}
+			},
+			want:    []string{"host.example."},
+			wantTTL: 2 * time.Minute,
+		},
+		{
+			name: "non-hostname target skipped",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, 0,
+					ptrAnswer(owner, "evil\x1b[2J.example.", 10),
+					ptrAnswer(owner, "host.example.", 300))}
+			},
+			want:    []string{"host.example."},
+			wantTTL: 300 * time.Second,
+		},
+		{
+			name: "only non-hostname targets",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, 0, ptrAnswer(owner, "a b.example.", 300))}
+			},
+			err: ErrNotFound,
+		},
+		{
+			name: "unrelated owner ignored",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, 0, ptrAnswer("6.2.0.192.in-addr.arpa.", "other.example.", 300))}
+			},
+			err: ErrNotFound,
+		},
+		{
+			name: "nxdomain",
+			udp: func(q []byte) [][]byte {
+				return [][]byte{reply(q, rcodeNXDomain)}
+			},
+			err: ErrNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newFakeServer(t, tc.udp, tc.tcp)
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			names, ttl, err := s.client().LookupPTR(ctx, addr)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if !slices.Equal(names, tc.want) || ttl != tc.wantTTL {
+				t.Errorf("got %q ttl %v, want %q ttl %v", names, ttl, tc.want, tc.wantTTL)
+			}
+		})
+	}
+}
+
+func TestClientLookupPTRMalformed(t *testing.T) {
+	s := newFakeServer(t, func(q []byte) [][]byte {
+		resp := reply(q, 0, ptrAnswer(reverseName(netip.MustParseAddr("192.0.2.5")), "host.example.", 300))
+		return [][]byte{resp[:len(resp)-2]}
+	}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, _, err := s.client().LookupPTR(ctx, netip.MustParseAddr("192.0.2.5")); !errors.Is(err, errMalformed) {
+		t.Fatalf("err = %v, want %v", err, errMalformed)
+	}
+}
+
+func FuzzParseResponse(f *testing.F) {
+	query := mustQuery(f, 7, "5.2.0.192.in-addr.arpa.", typePTR)
+	f.Add(reply(query, 0, ptrAnswer("5.2.0.192.in-addr.arpa.", "host.example.", 300)))
+	f.Add(reply(query, 0,
+		cnameAnswer("5.2.0.192.in-addr.arpa.", "5.0/25.2.0.192.in-addr.arpa.", 300),
+		addrAnswer("host.example.", netip.MustParseAddr("2001:db8::5"), 20)))
+	f.Add(append(slices.Clone(query), 0xc0, byte(len(query))))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		records, _, err := parseResponse(msg, 7)
+		if err != nil && records != nil {
+			t.Fatalf("records %v returned with error %v", records, err)
+		}
+		for _, rr := range records {
+			if rr.owner == "" || rr.owner[len(rr.owner)-1] != '.' {
+				t.Fatalf("owner %q not canonical", rr.owner)
+			}
+			switch rr.typ {
+			case typePTR, typeCNAME:
+				if rr.name == "" {
+					t.Fatalf("empty target in %+v", rr)
+				}
+			case typeA, typeAAAA:
+				if !rr.addr.IsValid() {
+					t.Fatalf("invalid address in %+v", rr)
+				}
+			default:
+				t.Fatalf("unexpected type in %+v", rr)
+			}
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package rdns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"secrds/internal/logger"
+)
+
+// maxNames bounds how many PTR names are forward-checked per address.
+const maxNames = 3
+
+// Resolver answers the two questions forward-confirmed reverse DNS needs.
+// Client talks to real servers; tests can supply their own.
+type Resolver interface {
+	LookupPTR(ctx context.Context, addr netip.Addr) ([]string, time.Duration, error)
+	LookupAddrs(ctx context.Context, name string) ([]netip.Addr, time.Duration, error)
+}
+
+type Options struct {
+	Workers     int
+	QueueSize   int
+	Timeout     time.Duration
+	MinTTL      time.Duration
+	MaxTTL      time.Duration
+	NegativeTTL time.Duration
+	CacheSize   int
+}
+
+// Result is the reverse DNS name of an address. Confirmed means one of
+// the name's A or AAAA records points back at the address; an unconfirmed
+// name is whatever the PTR record claims and may be forged.
+type Result struct {
+	Name      string    `json:"name,omitempty"`
+	Confirmed bool      `json:"confirmed"`
+	Expires   time.Time `json:"expires"`
+}
+
+func (r Result) Fields() []logger.Field {
+	if r.Name == "" {
+		return nil
+	}
+	return []logger.Field{logger.F("rdns", r.Name), logger.F("rdns_confirmed", r.Confirmed)}
+}
+
+// Cache resolves addresses in the background. Lookup never waits on the
+// network: it returns what is cached and queues the rest, and a full queue
+// drops the request so a DNS outage cannot back up event processing.
+type Cache struct {
+	resolver Resolver
+	opts     Options
+	onResult func(netip.Addr, Result)
+
+	mu      sync.Mutex
+	entries map[netip.Addr]Result
+	pending map[netip.Addr]bool
+
+	queue chan netip.Addr
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New starts opts.Workers resolver goroutines. onResult, if set, is called
+// from a worker for every completed resolution.
+func New(resolver Resolver, opts Options, onResult func(netip.Addr, Result)) *Cache {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 256
+	}
+	if opts.CacheSize < 1 {
+		opts.CacheSize = 4096
+	}
+	c := &Cache{
+		resolver: resolver,
+		opts:     opts,
+		onResult: onResult,
+		entries:  make(map[netip.Addr]Result),
+		pending:  make(map[netip.Addr]bool),
+		queue:    make(chan netip.Addr, opts.QueueSize),
+		stop:     make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		c.wg.Add(1)
+		go c.worker()
+	}
+	return c
+}
+
+// Close stops the workers; resolutions in flight finish within Timeout.
+func (c *Cache) Close() {
+	close(c.stop)
+	c.wg.Wait()
+}
+
+// Lookup returns the cached result for addr. On a miss or an expired entry
+// it queues a resolution and reports false.
+func (c *Cache) Lookup(addr netip.Addr) (Result, bool) {
+	if c == nil || !addr.IsValid() {
+		return Result{}, false
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsUnspecified() {
+		return Result{}, false
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	res, ok := c.entries[addr]
+	if ok && now.Before(res.Expires) {
+		c.mu.Unlock()
+		return res, true
+	}
+	if c.pending[addr] {
+		c.mu.Unlock()
+		return Result{}, false
+	}
+	select {
+	case c.queue <- addr:
+		c.pending[addr] = true
+	default:
+	}
+	c.mu.Unlock()
+	return Result{}, false
+}
+
+func (c *Cache) worker() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case addr := <-c.queue:
+			res := c.resolve(addr)
+
+			c.mu.Lock()
+			delete(c.pending, addr)
+			if len(c.entries) >= c.opts.CacheSize {
+				c.evict()
+			}
+			c.entries[addr] = res
+			c.mu.Unlock()
+
+			if c.onResult != nil {
+				c.onResult(addr, res)
+			}
+		}
+	}
+}
+
+// evict drops expired entries, or everything when none has expired. It
+// must be called with c.mu held.
+func (c *Cache) evict() {
+	now := time.Now()
+	for addr, res := range c.entries {
+		if !now.Before(res.Expires) {
+			delete(c.entries, addr)
+		}
+	}
+	if len(c.entries) >= c.opts.CacheSize {
+		c.entries = make(map[netip.Addr]Result)
+	}
+}
+
+// resolve looks up the PTR names of addr and forward-confirms them, all
+// within one Timeout.
+func (c *Cache) resolve(addr netip.Addr) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	names, ttl, err := c.resolver.LookupPTR(ctx, addr)
+	if err != nil || len(names) == 0 {
+		return Result{Expires: time.Now().Add(c.negativeTTL(err))}
+	}
+	if len(names) > maxNames {
+		names = names[:maxNames]
+	}
+
+	res := Result{Name: strings.TrimSuffix(names[0], ".")}
+	for _, name := range names {
+		addrs, fttl, err := c.resolver.LookupAddrs(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a.Unmap() == addr {
+				res = Result{Name: strings.TrimSuffix(name, "."), Confirmed: true}
+				ttl = min(ttl, fttl)
+				break
+			}
+		}
+		if res.Confirmed {
+			break
+		}
+	}
+	res.Expires = time.Now().Add(c.clampTTL(ttl))
+	return res
+}
+
+func (c *Cache) clampTTL(ttl time.Duration) time.Duration {
+	if ttl < c.opts.MinTTL {
+		ttl = c.opts.MinTTL
+	}
+	if c.opts.MaxTTL > 0 && ttl > c.opts.MaxTTL {
+		ttl = c.opts.MaxTTL
+	}
+	return ttl
+}
+
+// negativeTTL keeps missing names for NegativeTTL but retries failed
+// lookups (timeouts, server errors) sooner.
+func (c *Cache) negativeTTL(err error) time.Duration {
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return c.opts.NegativeTTL
+	}
+	return min(c.opts.NegativeTTL, time.Minute)
+}
@@ -0,0 +1,237 @@
+package rdns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers from fixed tables. If block is set, LookupPTR
+// waits on it first.
+type fakeResolver struct {
+	ptr   map[netip.Addr][]string
+	addrs map[string][]netip.Addr
+	ttl   time.Duration
+	err   error
+	block chan struct{}
+}
+
+func (r *fakeResolver) LookupPTR(ctx context.Context, addr netip.Addr) ([]string, time.Duration, error) {
+	if r.block != nil {
+		<-r.block
+	}
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	names, ok := r.ptr[addr]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	return names, r.ttl, nil
+}
+
+func (r *fakeResolver) LookupAddrs(ctx context.Context, name string) ([]netip.Addr, time.Duration, error) {
+	addrs, ok := r.addrs[name]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	return addrs, r.ttl, nil
+}
+
+// resolveOnce starts a cache, looks addr up and waits for the result.
+func resolveOnce(t *testing.T, resolver Resolver, opts Options, addr netip.Addr) Result {
+	t.Helper()
+	results := make(chan Result, 1)
+	c := New(resolver, opts, func(_ netip.Addr, res Result) { results <- res })
+	defer c.Close()
+	if _, ok := c.Lookup(addr); ok {
+		t.Fatal("hit on empty cache")
+	}
+	select {
+	case res := <-results:
+		if got, ok := c.Lookup(addr); !ok || got != res {
+			t.Errorf("Lookup after resolve = %+v %v, want %+v", got, ok, res)
+		}
+		return res
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result")
+		return Result{}
+	}
+}
+
+func TestCacheConfirm(t *testing.T) {
+	addr := netip.MustParseAddr("192.0.2.5")
+	owner := reverseName(addr)
+	for _, tc := range []struct {
+		name    string
+		ptr     []string
+		forward map[string][]netip.Addr
+		want    Result
+	}{
+		{
+			name:    "confirmed",
+			ptr:     []string{"host.example."},
+			forward: map[string][]netip.Addr{"host.example.": {addr}},
+			want:    Result{Name: "host.example", Confirmed: true},
+		},
+		{
+			name:    "second name confirms",
+			ptr:     []string{"forged.example.", "host.example."},
+			forward: map[string][]netip.Addr{"forged.example.": {netip.MustParseAddr("198.51.100.1")}, "host.example.": {addr}},
+			want:    Result{Name: "host.example", Confirmed: true},
+		},
+		{
+			name:    "points elsewhere",
+			ptr:     []string{"forged.example."},
+			forward: map[string][]netip.Addr{"forged.example.": {netip.MustParseAddr("198.51.100.1")}},
+			want:    Result{Name: "forged.example"},
+		},
+		{
+			name: "no forward records",
+			ptr:  []string{"forged.example."},
+			want: Result{Name: "forged.example"},
+		},
+		{
+			name: "no ptr",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newFakeServer(t, func(q []byte) [][]byte {
+				name, end, err := readName(q, headerLen)
+				if err != nil {
+					t.Error(err)
+					return nil
+				}
+				var answers []answer
+				qtype := uint16(q[end])<<8 | uint16(q[end+1])
+				switch {
+				case qtype == typePTR && name == owner:
+					for _, target := range tc.ptr {
+						answers = append(answers, ptrAnswer(owner, target, 300))
+					}
+				default:
+					for _, a := range tc.forward[name] {
+						if a.Is4() == (qtype == typeA) {
+							answers = append(answers, addrAnswer(name, a, 300))
+						}
+					}
+				}
+				if len(answers) == 0 {
+					return [][]byte{reply(q, rcodeNXDomain)}
+				}
+				return [][]byte{reply(q, 0, answers...)}
+			}, nil)
+
+			got := resolveOnce(t, s.client(), Options{Timeout: 2 * time.Second, NegativeTTL: time.Minute}, addr)
+			if got.Name != tc.want.Name || got.Confirmed != tc.want.Confirmed {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	addr := netip.MustParseAddr("192.0.2.5")
+	opts := Options{
+		Timeout:     time.Second,
+		MinTTL:      time.Minute,
+		MaxTTL:      time.Hour,
+		NegativeTTL: 10 * time.Minute,
+	}
+	for _, tc := range []struct {
+		name     string
+		resolver *fakeResolver
+		want     time.Duration
+	}{
+		{
+			name:     "raised to min",
+			resolver: &fakeResolver{ptr: map[netip.Addr][]string{addr: {"host.example."}}, ttl: time.Second},
+			want:     time.Minute,
+		},
+		{
+			name:     "lowered to max",
+			resolver: &fakeResolver{ptr: map[netip.Addr][]string{addr: {"host.example."}}, ttl: 24 * time.Hour},
+			want:     time.Hour,
+		},
+		{
+			name:     "within bounds",
+			resolver: &fakeResolver{ptr: map[netip.Addr][]string{addr: {"host.example."}}, ttl: 5 * time.Minute},
+			want:     5 * time.Minute,
+		},
+		{
+			name:     "not found",
+			resolver: &fakeResolver{},
+			want:     10 * time.Minute,
+		},
+		{
+			name:     "failure retried sooner",
+			resolver: &fakeResolver{err: errors.New("timeout")},
+			want:     time.Minute,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before := time.Now()
+			got := resolveOnce(t, tc.resolver, opts, addr)
+			after := time.Now()
+			if got.Expires.Before(before.Add(tc.want)) || got.Expires.After(after.Add(tc.want)) {
+				t.Errorf("expires in %v, want %v", got.Expires.Sub(before), tc.want)
+			}
+		})
+	}
+}
+
+func TestCacheQueueFull(t *testing.T) {
+	resolver := &fakeResolver{block: make(chan struct{})}
+	results := make(chan netip.Addr, 3)
+	c := New(resolver, Options{Workers: 1, QueueSize: 1, Timeout: time.Second}, func(addr netip.Addr, _ Result) {
+		results <- addr
+	})
+	defer c.Close()
+
+	first := netip.MustParseAddr("192.0.2.1")
+	second := netip.MustParseAddr("192.0.2.2")
+	dropped := netip.MustParseAddr("192.0.2.3")
+
+	c.Lookup(first)
+	// Wait for the worker to take first so the queue is empty again.
+	for deadline := time.Now().Add(5 * time.Second); len(c.queue) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("worker did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Lookup(second)
+	c.Lookup(dropped)
+
+	c.mu.Lock()
+	queued := c.pending[dropped]
+	c.mu.Unlock()
+	if queued {
+		t.Fatal("request queued past QueueSize")
+	}
+
+	close(resolver.block)
+	for _, want := range []netip.Addr{first, second} {
+		select {
+		case got := <-results:
+			if got != want {
+				t.Fatalf("resolved %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v not resolved", want)
+		}
+	}
+
+	// A dropped request is queued again by the next Lookup.
+	c.Lookup(dropped)
+	select {
+	case got := <-results:
+		if got != dropped {
+			t.Fatalf("resolved %v, want %v", got, dropped)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dropped address not retried")
+	}
+}
@@ -0,0 +1,192 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"secrds/internal/alert"
+	"secrds/internal/logger"
+	"secrds/internal/sockdiag"
+
+	"golang.org/x/sys/unix"
+)
+
+// Ban is an address whose connections secrds cuts as soon as it sees them.
+// A zero Until lasts until secrds restarts or the address is unbanned.
+type Ban struct {
+	Addr   netip.Addr `json:"addr"`
+	Source string     `json:"source"`
+	Reason string     `json:"reason"`
+	Since  time.Time  `json:"since"`
+	Until  time.Time  `json:"until,omitempty"`
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return !b.Until.IsZero() && now.After(b.Until)
+}
+
+// Responder holds the ban list and carries out the actions policies ask
+// for: resetting a TCP connection through sock_diag, or terminating the
+// per-connection daemon process once authentication has started.
+type Responder struct {
+	logger  *logger.Logger
+	alerts  *alert.Dispatcher
+	sockets *sockdiag.Resolver
+
+	mu   sync.Mutex
+	bans map[netip.Addr]*Ban
+}
+
+func New(lg *logger.Logger, alerts *alert.Dispatcher) *Responder {
+	return &Responder{
+		logger:  lg,
+		alerts:  alerts,
+		sockets: sockdiag.NewResolver(0),
+		bans:    make(map[netip.Addr]*Ban),
+	}
+}
+
+// Open prepares connection resets in secrds' own network namespace. It
+// must run before privileges are dropped.
+func (r *Responder) Open() error {
+	return r.sockets.OpenHost()
+}
+
+func (r *Responder) Close() error {
+	return r.sockets.Close()
+}
+
+// Ban adds addr to the ban list for d (0 means no expiry) and raises an
+// ip_banned alert. Banning an address again extends or shortens the
+// existing ban and is not alerted again.
+func (r *Responder) Ban(addr netip.Addr, source, reason string, d time.Duration, fields ...logger.Field) {
+	if r == nil || !addr.IsValid() {
+		return
+	}
+	addr = addr.Unmap()
+	now := time.Now()
+	b := &Ban{Addr: addr, Source: source, Reason: reason, Since: now}
+	if d > 0 {
+		b.Until = now.Add(d)
+	}
+
+	r.mu.Lock()
+	prev, existed := r.bans[addr]
+	if existed && !prev.expired(now) {
+		b.Since = prev.Since
+	} else {
+		existed = false
+	}
+	r.bans[addr] = b
+	r.mu.Unlock()
+
+	if existed {
+		return
+	}
+	until := "until unbanned"
+	if d > 0 {
+		until = "for " + d.String()
+	}
+	r.alerts.Raise(alert.Alert{
+		Type:     "ip_banned",
+		Severity: alert.SeverityCritical,
+		Message:  fmt.Sprintf("Banned %s %s: %s", addr, until, reason),
+		Fields:   append([]logger.Field{logger.F("ip", addr), logger.F("source", source)}, fields...),
+	})
+}
+
+func (r *Responder) Banned(addr netip.Addr) (Ban, bool) {
+	if r == nil || !addr.IsValid() {
+		return Ban{}, false
+	}
+	addr = addr.Unmap()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bans[addr]
+	if !ok {
+		return Ban{}, false
+	}
+	if b.expired(time.Now()) {
+		delete(r.bans, addr)
+		return Ban{}, false
+	}
+	return *b, true
+}
+
+func (r *Responder) Unban(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.bans[addr]
+	delete(r.bans, addr)
+	return ok
+}
+
+// Bans lists the active bans ordered by address.
+func (r *Responder) Bans() []Ban {
+	now := time.Now()
+	r.mu.Lock()
+	bans := make([]Ban, 0, len(r.bans))
+	for addr, b := range r.bans {
+		if b.expired(now) {
+			delete(r.bans, addr)
+			continue
+		}
+		bans = append(bans, *b)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Addr.Less(bans[j].Addr) })
+	return bans
+}
+
+// DropConnection resets the accepted connection from remote to local in
+// the network namespace of pid.
+func (r *Responder) DropConnection(pid uint32, local, remote netip.AddrPort) error {
+	local = netip.AddrPortFrom(local.Addr().Unmap(), local.Port())
+	remote = netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())
+	if err := r.sockets.Destroy(pid, local, remote); err != nil {
+		return fmt.Errorf("failed to reset %s -> %s: %w", remote, local, err)
+	}
+	return nil
+}
+
+// Terminate kills the per-connection process pid. The caller must make
+// sure pid serves a single connection, never the listening daemon; check
+// runs after the process is pinned with a pidfd, so a PID reused in the
+// meantime cannot be killed in its place.
+func (r *Responder) Terminate(pid uint32, check func() error) error {
+	if pid <= 1 {
+		return fmt.Errorf("refusing to terminate PID %d", pid)
+	}
+	fd, err := unix.PidfdOpen(int(pid), 0)
+	if errors.Is(err, unix.ENOSYS) {
+		// Before Linux 5.3 there is no pidfd; fall back to the bare PID.
+		if err := check(); err != nil {
+			return err
+		}
+		if err := unix.Kill(int(pid), unix.SIGKILL); err != nil {
+			return fmt.Errorf("failed to terminate PID %d: %w", pid, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open PID %d: %w", pid, err)
+	}
+	defer unix.Close(fd)
+
+	if err := check(); err != nil {
+		return err
+	}
+	// If pid exited after PidfdOpen, the signal fails with ESRCH rather
+	// than reaching whatever reused the PID.
+	if err := unix.PidfdSendSignal(fd, unix.SIGKILL, nil, 0); err != nil {
+		return fmt.Errorf("failed to terminate PID %d: %w", pid, err)
+	}
+	return nil
+}
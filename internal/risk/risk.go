@@ -0,0 +1,441 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"secrds/internal/config"
+)
+
+// Signal names, also the keys of Score.Breakdown and Score.Counts.
+const (
+	SignalFailure           = "failure"
+	SignalNewUsername       = "new_username"
+	SignalThreatFeed        = "threat_feed"
+	SignalGeoNovelty        = "geo_novelty"
+	SignalPreAuthDisconnect = "preauth_disconnect"
+	SignalConnection        = "connection"
+)
+
+type signal int
+
+const (
+	sigFailure signal = iota
+	sigNewUsername
+	sigThreatFeed
+	sigGeoNovelty
+	sigPreAuthDisconnect
+	sigConnection
+	numSignals
+)
+
+var signalNames = [numSignals]string{
+	SignalFailure,
+	SignalNewUsername,
+	SignalThreatFeed,
+	SignalGeoNovelty,
+	SignalPreAuthDisconnect,
+	SignalConnection,
+}
+
+const (
+	// maxUsernames bounds the usernames remembered per address; further
+	// names still count as failures but no longer as new usernames.
+	maxUsernames = 64
+	maxPending   = 256
+	// forgetBelow drops addresses whose score has decayed to nothing.
+	forgetBelow = 0.5
+)
+
+// Score is the current risk of one address. Breakdown holds the decayed
+// points per signal and Counts the number of times each signal was seen.
+type Score struct {
+	Addr      netip.Addr         `json:"addr"`
+	Score     float64            `json:"score"`
+	Band      string             `json:"band,omitempty"`
+	Breakdown map[string]float64 `json:"breakdown"`
+	Counts    map[string]int     `json:"counts"`
+	Usernames int                `json:"usernames"`
+	FirstSeen time.Time          `json:"first_seen"`
+	LastSeen  time.Time          `json:"last_seen"`
+}
+
+// Summary lists the non-zero parts of the breakdown, largest first.
+func (s Score) Summary() string {
+	signals := make([]string, 0, len(s.Breakdown))
+	for signal, points := range s.Breakdown {
+		if points >= 0.05 {
+			signals = append(signals, signal)
+		}
+	}
+	sort.Slice(signals, func(i, j int) bool { return s.Breakdown[signals[i]] > s.Breakdown[signals[j]] })
+
+	parts := make([]string, len(signals))
+	for i, signal := range signals {
+		parts[i] = fmt.Sprintf("%s=%.1f", signal, s.Breakdown[signal])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Change is the state of an address after a signal was recorded. Entered
+// is set when the score has just risen into a band.
+type Change struct {
+	Score   Score
+	Entered *config.RiskBand
+}
+
+type entry struct {
+	points    [numSignals]float64
+	counts    [numSignals]int
+	updated   time.Time
+	first     time.Time
+	seen      time.Time
+	usernames map[string]bool
+	feed      bool
+	novel     bool
+	band      int
+	pending   []time.Time
+}
+
+// Engine keeps a decaying score per source address. Each signal adds its
+// weight; every score halves each half-life, so a steady connection rate
+// settles at rate * weight * half_life / ln 2 instead of growing forever.
+type Engine struct {
+	mu        sync.Mutex
+	cfg       config.Risk
+	entries   map[netip.Addr]*entry
+	countries map[string]bool
+	now       func() time.Time // replaced by tests
+}
+
+func New(cfg config.Risk) *Engine {
+	return &Engine{
+		cfg:       cfg,
+		entries:   make(map[netip.Addr]*entry),
+		countries: make(map[string]bool),
+		now:       time.Now,
+	}
+}
+
+// Configure applies new weights and bands. Current scores are kept and
+// placed in the new bands without raising alerts.
+func (e *Engine) Configure(cfg config.Risk) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cfg = cfg
+	if !cfg.Enabled {
+		e.entries = make(map[netip.Addr]*entry)
+		return
+	}
+	now := e.now()
+	for _, en := range e.entries {
+		e.decay(en, now)
+		en.band = e.bandOf(total(en))
+	}
+}
+
+// Connection records an accepted connection from addr. With preauth set,
+// the connection counts as a pre-auth disconnect unless PAM sees the
+// address within the pre-auth timeout. Once a login has succeeded from
+// some country, the first connection of an address from any other country
+// adds the geo novelty weight.
+func (e *Engine) Connection(addr netip.Addr, country string, preauth bool) Change {
+	return e.record(addr, func(en *entry, now time.Time, w config.RiskWeights) {
+		e.add(en, sigConnection, w.Connection)
+		if country != "" && !en.novel && len(e.countries) > 0 && !e.countries[country] {
+			en.novel = true
+			e.add(en, sigGeoNovelty, w.GeoNovelty)
+		}
+		if preauth && len(en.pending) < maxPending {
+			en.pending = append(en.pending, now)
+		}
+	})
+}
+
+// ThreatFeed records that feeds list addr with the given highest score.
+// It counts once per address.
+func (e *Engine) ThreatFeed(addr netip.Addr, score float64) Change {
+	return e.record(addr, func(en *entry, now time.Time, w config.RiskWeights) {
+		if en.feed || score <= 0 {
+			return
+		}
+		en.feed = true
+		e.add(en, sigThreatFeed, w.ThreatFeed*score/100)
+	})
+}
+
+// Failure records a failed authentication from addr for user.
+func (e *Engine) Failure(addr netip.Addr, user string) Change {
+	return e.record(addr, func(en *entry, now time.Time, w config.RiskWeights) {
+		en.pending = nil
+		e.add(en, sigFailure, w.Failure)
+		if user != "" && !en.usernames[user] && len(en.usernames) < maxUsernames {
+			if en.usernames == nil {
+				en.usernames = make(map[string]bool)
+			}
+			en.usernames[user] = true
+			e.add(en, sigNewUsername, w.NewUsername)
+		}
+	})
+}
+
+// AuthActivity records that PAM saw addr, so its pending connections did
+// not disconnect before authenticating.
+func (e *Engine) AuthActivity(addr netip.Addr) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if en := e.entries[addr.Unmap()]; en != nil {
+		en.pending = nil
+	}
+}
+
+// Success records a successful login from addr and learns its country as
+// one that users log in from.
+func (e *Engine) Success(addr netip.Addr, country string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.cfg.Enabled {
+		return
+	}
+	if country != "" {
+		e.countries[country] = true
+	}
+	if en := e.entries[addr.Unmap()]; en != nil {
+		en.pending = nil
+	}
+}
+
+// Sweep turns connections that saw no PAM activity within the pre-auth
+// timeout into pre-auth disconnects, moves decayed scores down their bands
+// and forgets addresses whose score has decayed away. It returns the
+// addresses that rose into a band.
+func (e *Engine) Sweep() []Change {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.cfg.Enabled {
+		return nil
+	}
+
+	now := e.now()
+	deadline := now.Add(-e.cfg.PreAuthTimeout.Duration)
+	var changes []Change
+	for addr, en := range e.entries {
+		e.decay(en, now)
+		expired := 0
+		for expired < len(en.pending) && en.pending[expired].Before(deadline) {
+			expired++
+		}
+		if expired > 0 {
+			en.pending = en.pending[expired:]
+			for i := 0; i < expired; i++ {
+				e.add(en, sigPreAuthDisconnect, e.cfg.Weights.PreAuthDisconnect)
+			}
+		}
+
+		if total(en) < forgetBelow && len(en.pending) == 0 {
+			delete(e.entries, addr)
+			continue
+		}
+		if ch := e.settle(addr, en); ch.Entered != nil {
+			changes = append(changes, ch)
+		}
+	}
+	return changes
+}
+
+// Lookup returns the current score of addr.
+func (e *Engine) Lookup(addr netip.Addr) (Score, bool) {
+	if e == nil {
+		return Score{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	addr = addr.Unmap()
+	en := e.entries[addr]
+	if en == nil {
+		return Score{}, false
+	}
+	e.decay(en, e.now())
+	return e.score(addr, en), true
+}
+
+// Top returns the n highest scores, highest first.
+func (e *Engine) Top(n int) []Score {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	scores := make([]Score, 0, len(e.entries))
+	for addr, en := range e.entries {
+		e.decay(en, now)
+		scores = append(scores, e.score(addr, en))
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	if len(scores) > n {
+		scores = scores[:n]
+	}
+	return scores
+}
+
+func (e *Engine) record(addr netip.Addr, update func(en *entry, now time.Time, w config.RiskWeights)) Change {
+	if e == nil || !addr.IsValid() {
+		return Change{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.cfg.Enabled {
+		return Change{}
+	}
+
+	addr = addr.Unmap()
+	now := e.now()
+	en := e.entries[addr]
+	if en == nil {
+		if len(e.entries) >= e.cfg.MaxTracked {
+			e.evict(now)
+		}
+		en = &entry{
+			updated: now,
+			first:   now,
+			band:    -1,
+		}
+		e.entries[addr] = en
+	}
+	e.decay(en, now)
+	en.seen = now
+	update(en, now, e.cfg.Weights)
+	return e.settle(addr, en)
+}
+
+// settle moves en to the band its score is in and reports entering a
+// higher one.
+func (e *Engine) settle(addr netip.Addr, en *entry) Change {
+	band := e.bandOf(total(en))
+	ch := Change{}
+	if band > en.band {
+		ch.Entered = &e.cfg.Bands[band]
+	}
+	en.band = band
+	ch.Score = e.score(addr, en)
+	return ch
+}
+
+// evict makes room for new addresses in one pass. It forgets scores
+// that have decayed away and, if that is not enough, the lowest tenth, so
+// a scan from many addresses pays for a pass only every MaxTracked/10 new
+// addresses rather than on each one.
+func (e *Engine) evict(now time.Time) {
+	totals := make([]float64, 0, len(e.entries))
+	for addr, en := range e.entries {
+		e.decay(en, now)
+		t := total(en)
+		if t < forgetBelow && len(en.pending) == 0 {
+			delete(e.entries, addr)
+			continue
+		}
+		totals = append(totals, t)
+	}
+
+	target := e.cfg.MaxTracked - max(e.cfg.MaxTracked/10, 1)
+	excess := len(totals) - target
+	if excess <= 0 {
+		return
+	}
+	slices.Sort(totals)
+	cutoff := totals[excess-1]
+	for addr, en := range e.entries {
+		if excess == 0 {
+			break
+		}
+		if total(en) <= cutoff {
+			delete(e.entries, addr)
+			excess--
+		}
+	}
+}
+
+func (e *Engine) add(en *entry, sig signal, points float64) {
+	en.counts[sig]++
+	if points > 0 {
+		en.points[sig] += points
+	}
+}
+
+func (e *Engine) decay(en *entry, now time.Time) {
+	elapsed := now.Sub(en.updated)
+	if elapsed <= 0 {
+		return
+	}
+	factor := math.Exp2(-float64(elapsed) / float64(e.cfg.HalfLife.Duration))
+	for sig := range en.points {
+		en.points[sig] *= factor
+	}
+	en.updated = now
+}
+
+func (e *Engine) bandOf(score float64) int {
+	band := -1
+	for i, b := range e.cfg.Bands {
+		if score >= b.Score {
+			band = i
+		}
+	}
+	return band
+}
+
+func (e *Engine) score(addr netip.Addr, en *entry) Score {
+	s := Score{
+		Addr:      addr,
+		Score:     round(total(en)),
+		Breakdown: make(map[string]float64, numSignals),
+		Counts:    make(map[string]int, numSignals),
+		Usernames: len(en.usernames),
+		FirstSeen: en.first,
+		LastSeen:  en.seen,
+	}
+	for sig, n := range en.counts {
+		if n > 0 {
+			s.Breakdown[signalNames[sig]] = round(en.points[sig])
+			s.Counts[signalNames[sig]] = n
+		}
+	}
+	if band := e.bandOf(total(en)); band >= 0 {
+		s.Band = e.cfg.Bands[band].Name
+	}
+	return s
+}
+
+func total(en *entry) float64 {
+	var sum float64
+	for _, points := range en.points {
+		sum += points
+	}
+	return sum
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
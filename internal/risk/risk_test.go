@@ -0,0 +1,233 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"testing"
+	"time"
+
+	"secrds/internal/config"
+)
+
+var (
+	addrA = netip.MustParseAddr("192.0.2.1")
+	addrB = netip.MustParseAddr("192.0.2.2")
+)
+
+func testConfig() config.Risk {
+	return config.Risk{
+		Enabled:        true,
+		HalfLife:       config.Duration{Duration: time.Hour},
+		PreAuthTimeout: config.Duration{Duration: 30 * time.Second},
+		MaxTracked:     100,
+		Weights: config.RiskWeights{
+			Failure:           10,
+			NewUsername:       5,
+			ThreatFeed:        30,
+			GeoNovelty:        15,
+			PreAuthDisconnect: 3,
+			Connection:        1,
+		},
+		Bands: []config.RiskBand{
+			{Name: "elevated", Score: 20},
+			{Name: "high", Score: 40},
+		},
+	}
+}
+
+// newTestEngine returns an engine whose clock only moves when advance is
+// called.
+func newTestEngine(cfg config.Risk) (*Engine, func(time.Duration)) {
+	e := New(cfg)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	return e, func(d time.Duration) { now = now.Add(d) }
+}
+
+func scoreOf(t *testing.T, e *Engine, addr netip.Addr) Score {
+	t.Helper()
+	s, ok := e.Lookup(addr)
+	if !ok {
+		t.Fatalf("%s not tracked", addr)
+	}
+	return s
+}
+
+func entered(ch Change) string {
+	if ch.Entered == nil {
+		return ""
+	}
+	return ch.Entered.Name
+}
+
+func TestDecay(t *testing.T) {
+	e, advance := newTestEngine(testConfig())
+	e.Failure(addrA, "")
+	e.Failure(addrA, "")
+
+	for _, want := range []float64{20, 10, 5, 2.5} {
+		if got := scoreOf(t, e, addrA).Score; got != want {
+			t.Fatalf("score %v, want %v", got, want)
+		}
+		advance(time.Hour)
+	}
+
+	// Half an hour leaves 1/sqrt(2) of the score.
+	e, advance = newTestEngine(testConfig())
+	e.Failure(addrA, "")
+	advance(30 * time.Minute)
+	if got, want := scoreOf(t, e, addrA).Score, round(10/math.Sqrt2); got != want {
+		t.Fatalf("after half a half-life: score %v, want %v", got, want)
+	}
+}
+
+func TestBandEntry(t *testing.T) {
+	e, advance := newTestEngine(testConfig())
+
+	steps := []struct {
+		score   float64
+		entered string
+	}{
+		{10, ""},
+		{20, "elevated"},
+		{30, ""},
+		{40, "high"},
+		{50, ""},
+	}
+	for i, step := range steps {
+		ch := e.Failure(addrA, "")
+		if ch.Score.Score != step.score || entered(ch) != step.entered {
+			t.Fatalf("failure %d: score %v entered %q, want %v %q", i+1, ch.Score.Score, entered(ch), step.score, step.entered)
+		}
+	}
+
+	// Decaying down through the bands raises nothing.
+	advance(90 * time.Minute)
+	if changes := e.Sweep(); len(changes) != 0 {
+		t.Fatalf("sweep after decay: %+v", changes)
+	}
+	if s := scoreOf(t, e, addrA); s.Band != "" {
+		t.Fatalf("score %v still in band %q", s.Score, s.Band)
+	}
+
+	// Rising back into a band enters it again.
+	if ch := e.Failure(addrA, ""); entered(ch) != "elevated" {
+		t.Fatalf("score %v entered %q, want elevated", ch.Score.Score, entered(ch))
+	}
+}
+
+func TestConfigureRebands(t *testing.T) {
+	e, _ := newTestEngine(testConfig())
+	e.Failure(addrA, "")
+	e.Failure(addrA, "")
+	e.Failure(addrA, "")
+
+	cfg := testConfig()
+	cfg.Bands = []config.RiskBand{{Name: "elevated", Score: 10}, {Name: "high", Score: 25}}
+	e.Configure(cfg)
+	if s := scoreOf(t, e, addrA); s.Band != "high" {
+		t.Fatalf("band %q after configure, want high", s.Band)
+	}
+	if changes := e.Sweep(); len(changes) != 0 {
+		t.Fatalf("sweep after configure: %+v", changes)
+	}
+	if ch := e.Failure(addrA, ""); ch.Entered != nil {
+		t.Fatalf("entered %q, already in it since configure", entered(ch))
+	}
+
+	cfg.Enabled = false
+	e.Configure(cfg)
+	if _, ok := e.Lookup(addrA); ok {
+		t.Fatal("scores kept after disabling")
+	}
+	if ch := e.Failure(addrA, ""); ch.Score.Addr.IsValid() {
+		t.Fatalf("recorded while disabled: %+v", ch)
+	}
+}
+
+func TestSweepPreAuth(t *testing.T) {
+	e, advance := newTestEngine(testConfig())
+	addrC := netip.MustParseAddr("192.0.2.3")
+
+	e.Connection(addrA, "", true)
+	e.Connection(addrB, "", true)
+	e.Connection(addrC, "", true)
+	advance(10 * time.Second)
+	e.Connection(addrA, "", true)
+	e.AuthActivity(addrB)
+	e.Failure(addrC, "root")
+
+	e.Sweep()
+	if n := scoreOf(t, e, addrA).Counts[SignalPreAuthDisconnect]; n != 0 {
+		t.Fatalf("%d pre-auth disconnects before the timeout", n)
+	}
+
+	advance(25 * time.Second)
+	e.Sweep()
+	if n := scoreOf(t, e, addrA).Counts[SignalPreAuthDisconnect]; n != 1 {
+		t.Fatalf("%d pre-auth disconnects after the first timeout, want 1", n)
+	}
+	advance(10 * time.Second)
+	e.Sweep()
+	s := scoreOf(t, e, addrA)
+	if n := s.Counts[SignalPreAuthDisconnect]; n != 2 {
+		t.Fatalf("%d pre-auth disconnects after the second timeout, want 2", n)
+	}
+	for _, addr := range []netip.Addr{addrB, addrC} {
+		if n := scoreOf(t, e, addr).Counts[SignalPreAuthDisconnect]; n != 0 {
+			t.Fatalf("%s: %d pre-auth disconnects after PAM saw it", addr, n)
+		}
+	}
+
+	// Decayed scores are forgotten.
+	advance(24 * time.Hour)
+	e.Sweep()
+	for _, addr := range []netip.Addr{addrA, addrB, addrC} {
+		if _, ok := e.Lookup(addr); ok {
+			t.Fatalf("%s still tracked after decaying away", addr)
+		}
+	}
+}
+
+func TestEvict(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxTracked = 10
+	e, advance := newTestEngine(cfg)
+
+	addrs := make([]netip.Addr, cfg.MaxTracked+1)
+	for i := range addrs {
+		addrs[i] = netip.MustParseAddr(fmt.Sprintf("198.51.100.%d", i+1))
+	}
+	// addrs[i] gets i+1 failures, so addrs[0] has the lowest score.
+	for i, addr := range addrs[:cfg.MaxTracked] {
+		for n := 0; n <= i; n++ {
+			e.Failure(addr, "")
+		}
+	}
+
+	// Reaching MaxTracked evicts the lowest tenth, one address here.
+	e.Connection(addrs[cfg.MaxTracked], "", false)
+	if _, ok := e.Lookup(addrs[0]); ok {
+		t.Fatal("lowest score not evicted")
+	}
+	for _, addr := range addrs[1:] {
+		if _, ok := e.Lookup(addr); !ok {
+			t.Fatalf("%s evicted", addr)
+		}
+	}
+
+	// Once the connection-only score of addrs[MaxTracked] has decayed
+	// away, forgetting it makes enough room and the rest are kept.
+	advance(5 * time.Hour)
+	fresh := netip.MustParseAddr("203.0.113.1")
+	e.Connection(fresh, "", false)
+	if _, ok := e.Lookup(addrs[cfg.MaxTracked]); ok {
+		t.Fatal("decayed score not forgotten")
+	}
+	for _, addr := range append(addrs[1:cfg.MaxTracked], fresh) {
+		if _, ok := e.Lookup(addr); !ok {
+			t.Fatalf("%s evicted", addr)
+		}
+	}
+}
@@ -0,0 +1,685 @@
+package sockdiag
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sockDiagByFamily = 20
+	sockDestroy      = 21
+
+	sizeofNlMsghdr    = 16
+	sizeofInetDiagReq = 56
+	sizeofInetDiagMsg = 72
+
+	tcpEstablished = 1
+	tcpListen      = 10
+	allStates      = 0xffffffff
+	noCookie       = 0xffffffff
+	recvBufLen     = 1 << 16
+
+	// acceptedStates are the TCP states an accepted socket with an inode
+	// can be in: established and the closing states after it. Listening,
+	// SYN_SENT, TIME_WAIT and CLOSE sockets are left out of dumps.
+	acceptedStates = 1<<1 | 1<<4 | 1<<5 | 1<<8 | 1<<9 | 1<<11
+
+	minRefresh = 25 * time.Millisecond
+
+	// A socket holds its network namespace alive, so sockets for other
+	// namespaces are closed once idle and their number is capped.
+	netnsIdle   = time.Minute
+	maxNetnsFDs = 64
+)
+
+var (
+	ErrUnavailable = errors.New("sock_diag unavailable")
+	ErrNotFound    = errors.New("socket not found")
+)
+
+type Socket struct {
+	Family uint8
+	State  uint8
+	Local  netip.AddrPort
+	Remote netip.AddrPort
+	UID    uint32
+	Inode  uint32
+}
+
+func (s *Socket) Listening() bool {
+	return s.State == tcpListen
+}
+
+type snapshot struct {
+	taken   time.Time
+	byInode map[uint32]*Socket
+}
+
+// nsSocket is the sock_diag socket of one network namespace. Requests on
+// it are serialized by mu, which is held for the netlink round trip
+// instead of the Resolver's lock, so lookups in other namespaces and
+// cache hits do not wait for it.
+type nsSocket struct {
+	mu   sync.Mutex
+	fd   int       // -1 once closed; guarded by mu
+	used time.Time // guarded by Resolver.mu
+	// stale marks a socket evicted while in use; release closes it.
+	stale atomic.Bool
+}
+
+type Resolver struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	self  uint64
+	fds   map[uint64]*nsSocket
+	cache map[uint64]*snapshot
+	seq   atomic.Uint32
+}
+
+func NewResolver(ttl time.Duration) *Resolver {
+	// Sockets in our own namespace are opened without setns, which needs
+	// CAP_SYS_ADMIN and is gone once privileges are dropped.
+	self, _ := netnsKey("/proc/self/ns/net")
+	return &Resolver{
+		ttl:   ttl,
+		self:  self,
+		fds:   make(map[uint64]*nsSocket),
+		cache: make(map[uint64]*snapshot),
+	}
+}
+
+// OpenHost opens the socket for secrds' own network namespace ahead of
+// use. SOCK_DESTROY checks CAP_NET_ADMIN against whoever opened the socket
+// as well as the sender, so this runs before privileges are dropped.
+func (r *Resolver) OpenHost() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.self == 0 {
+		return fmt.Errorf("%w: own network namespace unknown", ErrUnavailable)
+	}
+	_, err := r.socketFor(r.self, "")
+	return err
+}
+
+func (r *Resolver) Close() error {
+	r.mu.Lock()
+	socks := r.fds
+	r.fds = make(map[uint64]*nsSocket)
+	r.cache = make(map[uint64]*snapshot)
+	r.mu.Unlock()
+
+	for _, sock := range socks {
+		sock.stale.Store(true)
+		sock.mu.Lock()
+		r.release(sock)
+	}
+	return nil
+}
+
+// ByFD finds the TCP socket behind descriptor fd of pid. The descriptor is
+// duplicated with pidfd_getfd to read its addresses, and the socket is
+// then looked up by that 4-tuple, so nothing is dumped. It fails with
+// ErrUnavailable where pidfd_getfd is missing or not permitted (Linux
+// before 5.6, no CAP_SYS_PTRACE, or Landlock); ByInode still works there.
+func (r *Resolver) ByFD(pid uint32, fd int) (*Socket, error) {
+	pidfd, err := unix.PidfdOpen(int(pid), 0)
+	if err != nil {
+		return nil, fdError(err)
+	}
+	dup, err := unix.PidfdGetfd(pidfd, fd, 0)
+	unix.Close(pidfd)
+	if err != nil {
+		return nil, fdError(err)
+	}
+	defer unix.Close(dup)
+
+	if proto, err := unix.GetsockoptInt(dup, unix.SOL_SOCKET, unix.SO_PROTOCOL); err != nil || proto != unix.IPPROTO_TCP {
+		return nil, ErrNotFound
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(dup, &st); err != nil {
+		return nil, err
+	}
+	sa, err := unix.Getsockname(dup)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{Inode: uint32(st.Ino)}
+	s.Family, s.Local = sockaddrAddr(sa)
+	if sa, err = unix.Getpeername(dup); errors.Is(err, unix.ENOTCONN) {
+		s.State = tcpListen
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	_, s.Remote = sockaddrAddr(sa)
+	if !s.Local.IsValid() || !s.Remote.IsValid() {
+		return nil, ErrNotFound
+	}
+
+	found, err := r.ByTuple(pid, s.Local, s.Remote)
+	switch {
+	case errors.Is(err, ErrUnavailable):
+		// No sock_diag in this namespace: the addresses are all there is.
+		s.State = tcpEstablished
+		return s, nil
+	case err != nil:
+		return nil, err
+	case found.Inode != s.Inode:
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func fdError(err error) error {
+	switch {
+	case errors.Is(err, unix.ESRCH), errors.Is(err, unix.EBADF):
+		return ErrNotFound
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		return fmt.Errorf("%w: pidfd_getfd: %v", ErrUnavailable, err)
+	}
+	return err
+}
+
+// sockaddrAddr returns the family and address of an inet socket address.
+// IPv4-mapped addresses keep their IPv6 form, which is what sock_diag
+// needs to find sockets of a dual-stack listener.
+func sockaddrAddr(sa unix.Sockaddr) (uint8, netip.AddrPort) {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return unix.AF_INET, netip.AddrPortFrom(netip.AddrFrom4(sa.Addr), uint16(sa.Port))
+	case *unix.SockaddrInet6:
+		return unix.AF_INET6, netip.AddrPortFrom(netip.AddrFrom16(sa.Addr), uint16(sa.Port))
+	}
+	return 0, netip.AddrPort{}
+}
+
+// ByTuple finds the TCP socket connecting local and remote in pid's
+// network namespace with a single exact-match request.
+func (r *Resolver) ByTuple(pid uint32, local, remote netip.AddrPort) (*Socket, error) {
+	ns, sock, err := r.acquire(pid)
+	if err != nil {
+		return nil, err
+	}
+	defer r.release(sock)
+
+	family := uint8(unix.AF_INET)
+	if local.Addr().Is6() {
+		family = unix.AF_INET6
+	}
+	s, err := r.lookup(sock.fd, family, &tuple{local: local, remote: remote})
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			r.drop(ns, sock)
+		}
+		return nil, err
+	}
+	// The kernel looks the tuple up like an incoming packet, so without a
+	// connection it returns the listener of the local port.
+	if s.Remote != unmapped(remote) || s.Local != unmapped(local) {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+func unmapped(ap netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// ByInode finds the connected TCP socket with inode in pid's network
+// namespace. inet_diag cannot match an inode in the kernel, so the
+// namespace's connected sockets are dumped once and cached for the
+// resolver's TTL; lookups of the many accepts in a burst share one dump.
+// Callers that know the descriptor use ByFD and fall back to this.
+func (r *Resolver) ByInode(pid uint32, inode uint64) (*Socket, error) {
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
+	ns, err := netnsKey(nsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok, err := r.cached(ns, inode); ok {
+		return s, err
+	}
+	_, sock, err := r.acquire(pid)
+	if err != nil {
+		return nil, err
+	}
+	defer r.release(sock)
+	// Another lookup may have refreshed the dump while this one waited.
+	if s, ok, err := r.cached(ns, inode); ok {
+		return s, err
+	}
+
+	snap := &snapshot{taken: time.Now(), byInode: make(map[uint32]*Socket)}
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		sockets, err := r.query(sock.fd, family, acceptedStates)
+		if err != nil {
+			r.drop(ns, sock)
+			return nil, err
+		}
+		for _, s := range sockets {
+			snap.byInode[s.Inode] = s
+		}
+	}
+	r.mu.Lock()
+	r.cache[ns] = snap
+	r.mu.Unlock()
+
+	if s, ok := snap.byInode[uint32(inode)]; ok {
+		return s, nil
+	}
+	return nil, ErrNotFound
+}
+
+// cached answers from the namespace's last dump. ok is false when a new
+// dump is needed.
+func (r *Resolver) cached(ns uint64, inode uint64) (*Socket, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snap, ok := r.cache[ns]
+	if !ok || time.Since(snap.taken) >= r.ttl {
+		return nil, false, nil
+	}
+	if s, ok := snap.byInode[uint32(inode)]; ok {
+		return s, true, nil
+	}
+	if time.Since(snap.taken) < minRefresh {
+		return nil, true, ErrNotFound
+	}
+	return nil, false, nil
+}
+
+// acquire returns the socket of pid's network namespace with its lock
+// held.
+func (r *Resolver) acquire(pid uint32) (uint64, *nsSocket, error) {
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
+	ns, err := netnsKey(nsPath)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	r.mu.Lock()
+	sock, err := r.socketFor(ns, nsPath)
+	r.mu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	sock.mu.Lock()
+	if sock.fd < 0 {
+		// Evicted or closed while this lookup waited for it.
+		sock.mu.Unlock()
+		return 0, nil, fmt.Errorf("%w: socket closed", ErrUnavailable)
+	}
+	return ns, sock, nil
+}
+
+// Destroy closes the TCP connection between local and remote in pid's
+// network namespace; the peer receives a reset. The kernel needs
+// CONFIG_INET_DIAG_DESTROY and the caller CAP_NET_ADMIN.
+func (r *Resolver) Destroy(pid uint32, local, remote netip.AddrPort) error {
+	_, sock, err := r.acquire(pid)
+	if err != nil {
+		return err
+	}
+	defer r.release(sock)
+
+	family := uint8(unix.AF_INET)
+	if local.Addr().Is6() {
+		family = unix.AF_INET6
+	}
+	return r.destroy(sock.fd, family, &tuple{local: local, remote: remote})
+}
+
+type tuple struct {
+	local  netip.AddrPort
+	remote netip.AddrPort
+}
+
+// socketFor returns the socket of namespace ns, opening it if needed. It
+// must be called with r.mu held.
+func (r *Resolver) socketFor(ns uint64, nsPath string) (*nsSocket, error) {
+	now := time.Now()
+	r.evictIdle(now)
+	if sock, ok := r.fds[ns]; ok {
+		sock.used = now
+		return sock, nil
+	}
+
+	var fd int
+	var err error
+	if ns == r.self {
+		fd, err = openSocket()
+	} else {
+		fd, err = socketInNetns(nsPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(r.fds) >= maxNetnsFDs {
+		r.evictOldest()
+	}
+	sock := &nsSocket{fd: fd, used: now}
+	r.fds[ns] = sock
+	return sock, nil
+}
+
+// evictIdle closes the sockets of other namespaces unused for netnsIdle,
+// releasing namespaces whose containers are gone.
+func (r *Resolver) evictIdle(now time.Time) {
+	for ns, sock := range r.fds {
+		if ns != r.self && now.Sub(sock.used) > netnsIdle {
+			r.evict(ns, sock)
+		}
+	}
+}
+
+func (r *Resolver) evictOldest() {
+	var oldest uint64
+	var used time.Time
+	for ns, sock := range r.fds {
+		if ns != r.self && (used.IsZero() || sock.used.Before(used)) {
+			oldest, used = ns, sock.used
+		}
+	}
+	if !used.IsZero() {
+		r.evict(oldest, r.fds[oldest])
+	}
+}
+
+// evict forgets the socket of ns and closes it, or leaves that to release
+// when a request is using it. It must be called with r.mu held.
+func (r *Resolver) evict(ns uint64, sock *nsSocket) {
+	delete(r.fds, ns)
+	delete(r.cache, ns)
+	sock.stale.Store(true)
+	if sock.mu.TryLock() {
+		sock.close()
+		sock.mu.Unlock()
+	}
+}
+
+// release unlocks a socket returned by acquire.
+func (r *Resolver) release(sock *nsSocket) {
+	if sock.stale.Load() {
+		sock.close()
+	}
+	sock.mu.Unlock()
+}
+
+// drop closes a socket whose request failed, so the next lookup opens a
+// fresh one. It must be called with sock.mu held and r.mu not held.
+func (r *Resolver) drop(ns uint64, sock *nsSocket) {
+	sock.close()
+	r.mu.Lock()
+	if r.fds[ns] == sock {
+		delete(r.fds, ns)
+	}
+	delete(r.cache, ns)
+	r.mu.Unlock()
+}
+
+func (s *nsSocket) close() {
+	if s.fd >= 0 {
+		unix.Close(s.fd)
+		s.fd = -1
+	}
+}
+
+func socketInNetns(nsPath string) (int, error) {
+	runtime.LockOSThread()
+
+	origNs, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return -1, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer origNs.Close()
+
+	targetNs, err := os.Open(nsPath)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return -1, err
+	}
+	defer targetNs.Close()
+
+	if err := unix.Setns(int(targetNs.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return -1, fmt.Errorf("%w: setns: %v", ErrUnavailable, err)
+	}
+
+	fd, sockErr := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+
+	if err := unix.Setns(int(origNs.Fd()), unix.CLONE_NEWNET); err != nil {
+		// The thread is stuck in the wrong namespace; leave it locked so the
+		// runtime discards it instead of reusing it.
+		if sockErr == nil {
+			unix.Close(fd)
+		}
+		return -1, fmt.Errorf("%w: restore netns: %v", ErrUnavailable, err)
+	}
+	runtime.UnlockOSThread()
+
+	if sockErr != nil {
+		return -1, fmt.Errorf("%w: %v", ErrUnavailable, sockErr)
+	}
+	return bindSocket(fd)
+}
+
+func openSocket() (int, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return -1, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return bindSocket(fd)
+}
+
+func bindSocket(fd int) (int, error) {
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("%w: bind: %v", ErrUnavailable, err)
+	}
+	return fd, nil
+}
+
+func (r *Resolver) request(msgType uint16, flags uint16, family uint8, states uint32, t *tuple) ([]byte, uint32) {
+	seq := r.seq.Add(1)
+
+	req := make([]byte, sizeofNlMsghdr+sizeofInetDiagReq)
+	binary.LittleEndian.PutUint32(req[0:4], uint32(len(req)))
+	binary.LittleEndian.PutUint16(req[4:6], msgType)
+	binary.LittleEndian.PutUint16(req[6:8], flags)
+	binary.LittleEndian.PutUint32(req[8:12], seq)
+
+	body := req[sizeofNlMsghdr:]
+	body[0] = family
+	body[1] = unix.IPPROTO_TCP
+	binary.LittleEndian.PutUint32(body[4:8], states)
+	if t != nil {
+		id := body[8:56]
+		binary.BigEndian.PutUint16(id[0:2], t.local.Port())
+		binary.BigEndian.PutUint16(id[2:4], t.remote.Port())
+		putAddr(id[4:20], t.local.Addr())
+		putAddr(id[20:36], t.remote.Addr())
+		binary.LittleEndian.PutUint32(id[40:44], noCookie)
+		binary.LittleEndian.PutUint32(id[44:48], noCookie)
+	}
+	return req, seq
+}
+
+func (r *Resolver) destroy(fd int, family uint8, t *tuple) error {
+	req, seq := r.request(sockDestroy, unix.NLM_F_REQUEST|unix.NLM_F_ACK, family, allStates, t)
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("sock_diag send: %w", err)
+	}
+
+	buf := make([]byte, recvBufLen)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("sock_diag recv: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return fmt.Errorf("sock_diag parse: %w", err)
+		}
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq || msg.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+			if len(msg.Data) < 4 {
+				return nil
+			}
+			switch errno := syscall.Errno(-int32(binary.LittleEndian.Uint32(msg.Data[0:4]))); errno {
+			case 0:
+				return nil
+			case syscall.ENOENT:
+				return ErrNotFound
+			default:
+				return fmt.Errorf("sock_diag destroy: %w", errno)
+			}
+		}
+	}
+}
+
+// lookup asks for the one TCP socket matching t.
+func (r *Resolver) lookup(fd int, family uint8, t *tuple) (*Socket, error) {
+	req, seq := r.request(sockDiagByFamily, unix.NLM_F_REQUEST, family, allStates, t)
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("sock_diag send: %w", err)
+	}
+
+	buf := make([]byte, recvBufLen)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("sock_diag recv: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("sock_diag parse: %w", err)
+		}
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq {
+				continue
+			}
+			switch msg.Header.Type {
+			case sockDiagByFamily:
+				if s := parseDiagMsg(msg.Data); s != nil {
+					return s, nil
+				}
+				return nil, fmt.Errorf("sock_diag: short reply")
+			case unix.NLMSG_ERROR:
+				if len(msg.Data) < 4 {
+					return nil, ErrNotFound
+				}
+				switch errno := syscall.Errno(-int32(binary.LittleEndian.Uint32(msg.Data[0:4]))); errno {
+				case 0, syscall.ENOENT:
+					return nil, ErrNotFound
+				default:
+					return nil, fmt.Errorf("sock_diag: %w", errno)
+				}
+			}
+		}
+	}
+}
+
+// query dumps the TCP sockets of family in the given states.
+func (r *Resolver) query(fd int, family uint8, states uint32) ([]*Socket, error) {
+	req, seq := r.request(sockDiagByFamily, unix.NLM_F_REQUEST|unix.NLM_F_DUMP, family, states, nil)
+
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("sock_diag send: %w", err)
+	}
+
+	var sockets []*Socket
+	buf := make([]byte, recvBufLen)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("sock_diag recv: %w", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("sock_diag parse: %w", err)
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq {
+				continue
+			}
+			switch msg.Header.Type {
+			case unix.NLMSG_DONE:
+				return sockets, nil
+			case unix.NLMSG_ERROR:
+				if len(msg.Data) >= 4 {
+					if errno := int32(binary.LittleEndian.Uint32(msg.Data[0:4])); errno != 0 {
+						if syscall.Errno(-errno) == syscall.ENOENT {
+							return nil, nil
+						}
+						return nil, fmt.Errorf("sock_diag: %w", syscall.Errno(-errno))
+					}
+				}
+				return sockets, nil
+			case sockDiagByFamily:
+				if s := parseDiagMsg(msg.Data); s != nil {
+					sockets = append(sockets, s)
+				}
+			}
+		}
+	}
+}
+
+func parseDiagMsg(data []byte) *Socket {
+	if len(data) < sizeofInetDiagMsg {
+		return nil
+	}
+
+	family := data[0]
+	id := data[4:52]
+	return &Socket{
+		Family: family,
+		State:  data[1],
+		Local:  netip.AddrPortFrom(parseAddr(family, id[4:20]), binary.BigEndian.Uint16(id[0:2])),
+		Remote: netip.AddrPortFrom(parseAddr(family, id[20:36]), binary.BigEndian.Uint16(id[2:4])),
+		UID:    binary.LittleEndian.Uint32(data[64:68]),
+		Inode:  binary.LittleEndian.Uint32(data[68:72]),
+	}
+}
+
+func parseAddr(family uint8, raw []byte) netip.Addr {
+	if family == unix.AF_INET {
+		return netip.AddrFrom4([4]byte(raw[:4]))
+	}
+	return netip.AddrFrom16([16]byte(raw[:16])).Unmap()
+}
+
+func putAddr(dst []byte, addr netip.Addr) {
+	if addr.Is4() {
+		a := addr.As4()
+		copy(dst, a[:])
+		return
+	}
+	a := addr.As16()
+	copy(dst, a[:])
+}
+
+func netnsKey(nsPath string) (uint64, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(nsPath, &st); err != nil {
+		return 0, err
+	}
+	return st.Ino, nil
+}
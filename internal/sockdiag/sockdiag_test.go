@@ -0,0 +1,129 @@
+package sockdiag
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// acceptedConn returns the descriptor and inode of the accepted side of an
+// IPv4 loopback connection to a dual-stack listener.
+func acceptedConn(t *testing.T) (int, uint64) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "[::]:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	c, err := net.DialTCP("tcp4", nil, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: ln.Addr().(*net.TCPAddr).Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	f, err := a.(*net.TCPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	var st unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &st); err != nil {
+		t.Fatal(err)
+	}
+	return int(f.Fd()), st.Ino
+}
+
+func TestLookups(t *testing.T) {
+	fd, inode := acceptedConn(t)
+	pid := uint32(os.Getpid())
+	r := NewResolver(0)
+	defer r.Close()
+
+	s, err := r.ByFD(pid, fd)
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(s.Inode) != inode || s.Local.Addr().Unmap().String() != "127.0.0.1" || s.Remote.Addr().Unmap().String() != "127.0.0.1" || s.Listening() {
+		t.Fatalf("ByFD: %+v, want inode %d", s, inode)
+	}
+
+	for name, lookup := range map[string]func() (*Socket, error){
+		"ByTuple":          func() (*Socket, error) { return r.ByTuple(pid, s.Local, s.Remote) },
+		"ByTuple unmapped": func() (*Socket, error) { return r.ByTuple(pid, unmapped(s.Local), unmapped(s.Remote)) },
+		"ByInode":          func() (*Socket, error) { return r.ByInode(pid, inode) },
+	} {
+		got, err := lookup()
+		if errors.Is(err, ErrUnavailable) {
+			t.Skip(err)
+		}
+		if err != nil || uint64(got.Inode) != inode {
+			t.Errorf("%s: got %+v, %v", name, got, err)
+		}
+	}
+
+	if _, err := r.ByFD(pid, 1<<20); !errors.Is(err, ErrNotFound) {
+		t.Errorf("closed descriptor: got %v", err)
+	}
+	if _, err := r.ByFD(pid, int(os.Stdin.Fd())); !errors.Is(err, ErrNotFound) {
+		t.Errorf("non-socket descriptor: got %v", err)
+	}
+	if _, err := r.ByTuple(pid, s.Local, unmapped(s.Local)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown tuple: got %v", err)
+	}
+}
+
+// TestConcurrentLookups runs lookups in parallel with eviction and Close;
+// it is meant for -race.
+func TestConcurrentLookups(t *testing.T) {
+	fd, inode := acceptedConn(t)
+	pid := uint32(os.Getpid())
+	r := NewResolver(0)
+	if _, err := r.ByInode(pid, inode); errors.Is(err, ErrUnavailable) {
+		t.Skip(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if s, err := r.ByInode(pid, inode); err == nil && uint64(s.Inode) != inode {
+					t.Errorf("ByInode returned inode %d", s.Inode)
+				}
+				r.ByFD(pid, fd)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 20; j++ {
+			r.mu.Lock()
+			for ns, sock := range r.fds {
+				r.evict(ns, sock)
+			}
+			r.mu.Unlock()
+		}
+	}()
+	wg.Wait()
+	r.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.fds) != 0 {
+		t.Fatalf("%d sockets left open", len(r.fds))
+	}
+}
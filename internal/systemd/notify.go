@@ -0,0 +1,99 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Notifier speaks the sd_notify protocol. A nil or unconnected Notifier
+// ignores every call, so callers need not check whether secrds runs
+// under systemd.
+type Notifier struct {
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewNotifier connects to $NOTIFY_SOCKET. The socket is dialled up front
+// so notifications keep working after privileges are dropped.
+func NewNotifier() (*Notifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return &Notifier{}, nil
+	}
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	return &Notifier{conn: conn}, nil
+}
+
+func (n *Notifier) Enabled() bool {
+	return n != nil && n.conn != nil
+}
+
+func (n *Notifier) Notify(states ...string) error {
+	if !n.Enabled() {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err := n.conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+func (n *Notifier) Ready(status string) error {
+	return n.Notify("READY=1", "STATUS="+status)
+}
+
+// Reloading tells systemd a reload has started. MONOTONIC_USEC lets it
+// tell this reload apart from earlier ones; follow up with Ready.
+func (n *Notifier) Reloading() error {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return err
+	}
+	return n.Notify("RELOADING=1", "MONOTONIC_USEC="+strconv.FormatInt(ts.Nano()/1000, 10))
+}
+
+func (n *Notifier) Status(status string) error {
+	return n.Notify("STATUS=" + status)
+}
+
+func (n *Notifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+func (n *Notifier) Close() error {
+	if !n.Enabled() {
+		return nil
+	}
+	return n.conn.Close()
+}
+
+// WatchdogInterval returns the interval configured with WatchdogSec=, or 0
+// when the watchdog is disabled or meant for another process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec == 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,71 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestReloading(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	n, err := NewNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	var before unix.Timespec
+	unix.ClockGettime(unix.CLOCK_MONOTONIC, &before)
+	if err := n.Reloading(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Ready("Monitoring"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 256)
+	ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+	size, err := ln.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(buf[:size]), "\n")
+	if len(lines) != 2 || lines[0] != "RELOADING=1" || !strings.HasPrefix(lines[1], "MONOTONIC_USEC=") {
+		t.Fatalf("reloading message %q", buf[:size])
+	}
+	usec, err := strconv.ParseInt(strings.TrimPrefix(lines[1], "MONOTONIC_USEC="), 10, 64)
+	if err != nil || usec < before.Nano()/1000 || usec > before.Nano()/1000+int64(time.Minute/time.Microsecond) {
+		t.Fatalf("MONOTONIC_USEC %q, clock was %dus", lines[1], before.Nano()/1000)
+	}
+
+	size, err = ln.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:size]); got != "READY=1\nSTATUS=Monitoring" {
+		t.Fatalf("ready message %q", got)
+	}
+}
+
+func TestNotifierDisabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n, err := NewNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Enabled() || n.Reloading() != nil || n.Ready("x") != nil {
+		t.Fatal("unconnected notifier sent")
+	}
+}
@@ -0,0 +1,91 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+type UnitOptions struct {
+	Binary    string
+	Config    string
+	ObjectDir string
+	Watchdog  string
+
+	// Directory names relative to /var/log and /run, created by systemd.
+	LogsDirectory    string
+	RuntimeDirectory string
+}
+
+// ExecStart names the generic secrds.bpf.o on purpose: the daemon loads
+// secrds.<GOARCH>.bpf.o (and the auth and exec objects) from the same
+// directory, so the unit does not depend on the host architecture.
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=secrds eBPF SSH and authentication monitor
+After=network.target
+Before=sshd.service ssh.service
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.Binary}} -config {{.Config}} {{.ObjectDir}}/secrds.bpf.o
+ExecReload=/bin/kill -HUP $MAINPID
+WorkingDirectory={{.ObjectDir}}
+WatchdogSec={{.Watchdog}}
+Restart=on-failure
+RestartSec=5s
+LimitMEMLOCK=infinity
+
+CapabilityBoundingSet=CAP_BPF CAP_PERFMON CAP_SYS_ADMIN CAP_SYS_RESOURCE CAP_SYS_PTRACE CAP_DAC_READ_SEARCH CAP_NET_ADMIN CAP_KILL CAP_SETUID CAP_SETGID CAP_SETPCAP
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=read-only
+LogsDirectory={{.LogsDirectory}}
+RuntimeDirectory={{.RuntimeDirectory}}
+RuntimeDirectoryMode=0750
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelModules=yes
+ProtectClock=yes
+ProtectHostname=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6 AF_NETLINK
+SystemCallArchitectures=native
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+func RenderUnit(opts UnitOptions) (string, error) {
+	var b strings.Builder
+	if err := unitTemplate.Execute(&b, opts); err != nil {
+		return "", fmt.Errorf("failed to render unit: %w", err)
+	}
+	return b.String(), nil
+}
+
+// WriteUnit writes the unit to path, refusing to replace an existing file
+// unless force is set.
+func WriteUnit(path string, opts UnitOptions, force bool) error {
+	unit, err := RenderUnit(opts)
+	if err != nil {
+		return err
+	}
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, use -force to replace it", path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create unit directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write unit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package threatintel
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"secrds/internal/config"
+	"secrds/internal/logger"
+)
+
+type feedState struct {
+	def     config.Feed
+	matches []Match
+	mtime   time.Time
+	size    int64
+}
+
+// Feeds keeps the configured reputation feeds loaded and rebuilds the
+// lookup table whenever a feed file changes on disk.
+type Feeds struct {
+	logger *logger.Logger
+	table  atomic.Pointer[Table]
+
+	mu     sync.Mutex
+	states []*feedState // see rebuild
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewFeeds(lg *logger.Logger) *Feeds {
+	f := &Feeds{logger: lg}
+	f.table.Store(newTable(nil))
+	return f
+}
+
+// Configure loads every feed in cfg and replaces the current set. The
+// current set stays in place when any feed fails to load.
+func (f *Feeds) Configure(cfg config.ThreatIntel) error {
+	apply, err := f.Prepare(cfg)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare loads every feed in cfg. The returned function replaces the
+// current set with them and restarts the file watcher.
+func (f *Feeds) Prepare(cfg config.ThreatIntel) (func(), error) {
+	states := make([]*feedState, 0, len(cfg.Feeds))
+	for _, def := range cfg.Feeds {
+		st, err := loadState(def)
+		if err != nil {
+			return nil, fmt.Errorf("feed %q: %w", def.Name, err)
+		}
+		states = append(states, st)
+	}
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.stopWatcher()
+		f.states = states
+		f.rebuild()
+		for _, st := range states {
+			f.logger.LogInfo("Loaded threat feed %s from %s: %d entries", st.def.Name, st.def.Path, len(st.matches))
+		}
+
+		if len(states) > 0 && cfg.CheckInterval.Duration > 0 {
+			f.stop = make(chan struct{})
+			f.done = make(chan struct{})
+			go f.watch(cfg.CheckInterval.Duration, f.stop, f.done)
+		}
+	}, nil
+}
+
+func (f *Feeds) Close() {
+	f.mu.Lock()
+	f.stopWatcher()
+	f.mu.Unlock()
+}
+
+func (f *Feeds) stopWatcher() {
+	if f.stop == nil {
+		return
+	}
+	close(f.stop)
+	<-f.done
+	f.stop, f.done = nil, nil
+}
+
+func loadState(def config.Feed) (*feedState, error) {
+	st, err := os.Stat(def.Path)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := load(def)
+	if err != nil {
+		return nil, err
+	}
+	return &feedState{def: def, matches: matches, mtime: st.ModTime(), size: st.Size()}, nil
+}
+
+// rebuild publishes a table built from f.states. The states belong to the
+// watcher while it runs; Configure stops it before replacing them.
+func (f *Feeds) rebuild() {
+	var all []Match
+	for _, st := range f.states {
+		all = append(all, st.matches...)
+	}
+	f.table.Store(newTable(all))
+}
+
+// watch reloads feeds that changed on disk. A feed that fails to load keeps
+// its previous entries and is reported once per version of the file.
+func (f *Feeds) watch(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reported := make(map[string]string)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+		for i, cur := range f.states {
+			st, err := os.Stat(cur.def.Path)
+			if err != nil || (st.ModTime().Equal(cur.mtime) && st.Size() == cur.size) {
+				continue
+			}
+			version := fmt.Sprintf("%d/%d", st.ModTime().UnixNano(), st.Size())
+			if reported[cur.def.Name] == version {
+				continue
+			}
+			next, err := loadState(cur.def)
+			if err != nil {
+				f.logger.LogError("Keeping previous entries of threat feed %s: %v", cur.def.Name, err)
+				reported[cur.def.Name] = version
+				continue
+			}
+			delete(reported, cur.def.Name)
+			f.logger.LogInfo("Reloaded threat feed %s: %d entries", cur.def.Name, len(next.matches))
+			f.states[i] = next
+			changed = true
+		}
+		if changed {
+			f.rebuild()
+		}
+	}
+}
+
+// Lookup returns the entries of every feed listing addr.
+func (f *Feeds) Lookup(addr netip.Addr) []Match {
+	if f == nil {
+		return nil
+	}
+	return f.table.Load().Lookup(addr)
+}
+
+// Fields tags an event with the feeds that list its address and the
+// highest score among them.
+func Fields(matches []Match) []logger.Field {
+	if len(matches) == 0 {
+		return nil
+	}
+	names := make([]string, len(matches))
+	score := matches[0].Score
+	for i, m := range matches {
+		names[i] = m.Feed
+		if m.Score > score {
+			score = m.Score
+		}
+	}
+	return []logger.Field{
+		logger.F("threat_feeds", strings.Join(names, ",")),
+		logger.F("threat_score", score),
+	}
+}
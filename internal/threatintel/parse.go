@@ -0,0 +1,143 @@
+package threatintel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"secrds/internal/config"
+)
+
+// maxBadLines is how many unparsable lines a feed may contain before it is
+// rejected as being in the wrong format.
+const maxBadLines = 100
+
+// load reads one feed file into matches.
+func load(feed config.Feed) ([]Match, error) {
+	f, err := os.Open(feed.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matches []Match
+	switch feed.Format {
+	case config.FeedCSV:
+		matches, err = parseCSV(f, feed)
+	default:
+		matches, err = parseList(f, feed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", feed.Path, err)
+	}
+	return matches, nil
+}
+
+func entry(feed config.Feed, prefix netip.Prefix, score float64) Match {
+	return Match{
+		Feed:        feed.Name,
+		Prefix:      prefix,
+		Score:       score,
+		Ban:         feed.Ban && score >= feed.BanScore,
+		BanDuration: feed.BanDuration.Duration,
+	}
+}
+
+// parseList reads FireHOL netsets and plain CIDR lists: one address or
+// prefix per line, with '#' and ';' comments.
+func parseList(r io.Reader, feed config.Feed) ([]Match, error) {
+	var matches []Match
+	bad := 0
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if fields := strings.Fields(text); len(fields) > 1 {
+			text = fields[0]
+		}
+		prefix, err := parsePrefix(text)
+		if err != nil {
+			if bad++; bad > maxBadLines {
+				return nil, fmt.Errorf("line %d: %w (too many bad lines)", line, err)
+			}
+			continue
+		}
+		matches = append(matches, entry(feed, prefix, feed.Score))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// parseCSV reads rows with an address or prefix and a score. A header row
+// and rows whose address does not parse are skipped.
+func parseCSV(r io.Reader, feed config.Feed) ([]Match, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	var matches []Match
+	bad := 0
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < feed.IPColumn || len(rec) < feed.ScoreColumn {
+			bad++
+		} else if prefix, err := parsePrefix(strings.TrimSpace(rec[feed.IPColumn-1])); err != nil {
+			bad++
+		} else if score, err := strconv.ParseFloat(strings.TrimSpace(rec[feed.ScoreColumn-1]), 64); err != nil {
+			bad++
+		} else {
+			matches = append(matches, entry(feed, prefix, score))
+			continue
+		}
+		if bad > maxBadLines {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: too many rows without an address and a score", line)
+		}
+	}
+	return matches, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if prefix.Addr().Is4In6() {
+		bits := prefix.Bits() - 96
+		if bits < 0 {
+			return netip.Prefix{}, fmt.Errorf("%s: mapped prefix shorter than /96", s)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), bits)
+	}
+	return prefix.Masked(), nil
+}
@@ -0,0 +1,117 @@
+package threatintel
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"secrds/internal/config"
+)
+
+func prefixes(matches []Match) []string {
+	out := make([]string, len(matches))
+	for i, m := range matches {
+		out[i] = m.Prefix.String()
+	}
+	return out
+}
+
+func TestParseList(t *testing.T) {
+	feed := config.Feed{Name: "firehol", Score: 40, Ban: true, BanScore: 30, BanDuration: config.Duration{Duration: time.Hour}}
+	input := strings.Join([]string{
+		"# FireHOL level 1",
+		"; also a comment",
+		"",
+		"192.0.2.0/24",
+		"  198.51.100.7  ",
+		"203.0.113.5/24 # host bits are masked",
+		"2001:db8::/32 extra columns ignored",
+		"::ffff:192.0.2.9",
+		"::ffff:10.0.0.0/104",
+		"not an address",
+		"10.0.0.0/33",
+	}, "\n")
+
+	matches, err := parseList(strings.NewReader(input), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.0/24", "198.51.100.7/32", "203.0.113.0/24", "2001:db8::/32", "192.0.2.9/32", "10.0.0.0/8"}
+	if got := prefixes(matches); !reflect.DeepEqual(got, want) {
+		t.Fatalf("prefixes %v, want %v", got, want)
+	}
+	if m := matches[0]; m.Feed != "firehol" || m.Score != 40 || !m.Ban || m.BanDuration != time.Hour {
+		t.Fatalf("entry %+v", m)
+	}
+}
+
+func TestParseListTooManyBadLines(t *testing.T) {
+	input := strings.Repeat("garbage\n", maxBadLines) + "192.0.2.1\n"
+	if matches, err := parseList(strings.NewReader(input), config.Feed{}); err != nil || len(matches) != 1 {
+		t.Fatalf("%d bad lines: got %d matches, %v", maxBadLines, len(matches), err)
+	}
+	input = strings.Repeat("garbage\n", maxBadLines+1)
+	if _, err := parseList(strings.NewReader(input), config.Feed{}); err == nil {
+		t.Fatalf("%d bad lines accepted", maxBadLines+1)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	feed := config.Feed{Name: "abuse", IPColumn: 2, ScoreColumn: 3, Ban: true, BanScore: 75}
+	input := strings.Join([]string{
+		"# exported list",
+		"id,ip,score",
+		"1, 192.0.2.5, 90",
+		"2,2001:db8::1,12.5",
+		"3,198.51.100.0/24,75",
+		"4,::ffff:203.0.113.9,50",
+		"5,not an address,99",
+		"6,192.0.2.6,high",
+		"7,192.0.2.7",
+	}, "\n")
+
+	matches, err := parseCSV(strings.NewReader(input), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Match{
+		{Feed: "abuse", Prefix: netip.MustParsePrefix("192.0.2.5/32"), Score: 90, Ban: true},
+		{Feed: "abuse", Prefix: netip.MustParsePrefix("2001:db8::1/128"), Score: 12.5},
+		{Feed: "abuse", Prefix: netip.MustParsePrefix("198.51.100.0/24"), Score: 75, Ban: true},
+		{Feed: "abuse", Prefix: netip.MustParsePrefix("203.0.113.9/32"), Score: 50},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("got %+v, want %+v", matches, want)
+	}
+}
+
+func TestParseCSVTooManyBadRows(t *testing.T) {
+	feed := config.Feed{IPColumn: 1, ScoreColumn: 2}
+	input := strings.Repeat("192.0.2.1\n", maxBadLines+1)
+	if _, err := parseCSV(strings.NewReader(input), feed); err == nil {
+		t.Fatalf("%d rows without a score accepted", maxBadLines+1)
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":            "192.0.2.1/32",
+		"192.0.2.1/24":         "192.0.2.0/24",
+		"2001:db8::1":          "2001:db8::1/128",
+		"::ffff:192.0.2.1":     "192.0.2.1/32",
+		"::ffff:192.0.2.0/120": "192.0.2.0/24",
+	}
+	for in, want := range tests {
+		got, err := parsePrefix(in)
+		if err != nil || got.String() != want {
+			t.Errorf("%s: got %v, %v, want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "192.0.2.256", "192.0.2.0/33", "::ffff:0.0.0.0/95", "host.example"} {
+		if got, err := parsePrefix(in); err == nil {
+			t.Errorf("%q: accepted as %v", in, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package threatintel
+
+import (
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// Match is a feed entry covering a looked-up address.
+type Match struct {
+	Feed        string        `json:"feed"`
+	Prefix      netip.Prefix  `json:"prefix"`
+	Score       float64       `json:"score"`
+	Ban         bool          `json:"-"`
+	BanDuration time.Duration `json:"-"`
+}
+
+// level holds every prefix of one length, keyed by the masked prefix.
+type level struct {
+	bits    int
+	entries map[netip.Prefix][]Match
+}
+
+// Table is an immutable set of prefixes from any number of feeds. Lookups
+// probe one hash map per distinct prefix length, so their cost depends on
+// how many lengths the feeds use, not on how many entries they hold.
+type Table struct {
+	v4 []level
+	v6 []level
+}
+
+func newTable(matches []Match) *Table {
+	byLen := map[bool]map[int]map[netip.Prefix][]Match{true: {}, false: {}}
+	for _, m := range matches {
+		is4 := m.Prefix.Addr().Is4()
+		lv := byLen[is4][m.Prefix.Bits()]
+		if lv == nil {
+			lv = make(map[netip.Prefix][]Match)
+			byLen[is4][m.Prefix.Bits()] = lv
+		}
+		lv[m.Prefix] = merge(lv[m.Prefix], m)
+	}
+
+	t := &Table{}
+	for is4, lengths := range byLen {
+		levels := make([]level, 0, len(lengths))
+		for bits, entries := range lengths {
+			levels = append(levels, level{bits: bits, entries: entries})
+		}
+		// Longest prefixes first, so the most specific entry of a feed wins.
+		sort.Slice(levels, func(i, j int) bool { return levels[i].bits > levels[j].bits })
+		if is4 {
+			t.v4 = levels
+		} else {
+			t.v6 = levels
+		}
+	}
+	return t
+}
+
+// Lookup returns the most specific entry of every feed that covers addr.
+func (t *Table) Lookup(addr netip.Addr) []Match {
+	if t == nil || !addr.IsValid() {
+		return nil
+	}
+	addr = addr.Unmap()
+	levels := t.v6
+	if addr.Is4() {
+		levels = t.v4
+	}
+
+	var found []Match
+	for _, lv := range levels {
+		p, err := addr.Prefix(lv.bits)
+		if err != nil {
+			continue
+		}
+		for _, m := range lv.entries[p] {
+			if !hasFeed(found, m.Feed) {
+				found = append(found, m)
+			}
+		}
+	}
+	return found
+}
+
+func (t *Table) Len() int {
+	n := 0
+	for _, levels := range [][]level{t.v4, t.v6} {
+		for _, lv := range levels {
+			n += len(lv.entries)
+		}
+	}
+	return n
+}
+
+// merge adds m to the entries of one prefix. A feed listing the prefix
+// more than once, as score CSVs often do, keeps its highest score.
+func merge(entries []Match, m Match) []Match {
+	for i, e := range entries {
+		if e.Feed == m.Feed {
+			if m.Score > e.Score {
+				entries[i] = m
+			}
+			return entries
+		}
+	}
+	return append(entries, m)
+}
+
+func hasFeed(matches []Match, feed string) bool {
+	for _, m := range matches {
+		if m.Feed == feed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package threatintel
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func match(feed, prefix string, score float64) Match {
+	return Match{Feed: feed, Prefix: netip.MustParsePrefix(prefix), Score: score}
+}
+
+func TestTableLookup(t *testing.T) {
+	table := newTable([]Match{
+		match("firehol", "192.0.2.0/24", 40),
+		match("firehol", "192.0.2.128/25", 60),
+		match("firehol", "192.0.2.200/32", 80),
+		match("abuse", "192.0.0.0/16", 10),
+		match("abuse", "192.0.2.7/32", 20),
+		match("abuse", "192.0.2.7/32", 95),
+		match("abuse", "192.0.2.7/32", 50),
+		match("v6", "2001:db8::/32", 30),
+		match("v6", "2001:db8:1::/48", 35),
+	})
+
+	tests := map[string][]Match{
+		"192.0.2.1": {
+			match("firehol", "192.0.2.0/24", 40),
+			match("abuse", "192.0.0.0/16", 10),
+		},
+		"192.0.2.129": {
+			match("firehol", "192.0.2.128/25", 60),
+			match("abuse", "192.0.0.0/16", 10),
+		},
+		"192.0.2.200": {
+			match("firehol", "192.0.2.200/32", 80),
+			match("abuse", "192.0.0.0/16", 10),
+		},
+		"192.0.2.7": {
+			match("abuse", "192.0.2.7/32", 95),
+			match("firehol", "192.0.2.0/24", 40),
+		},
+		"::ffff:192.0.2.7": {
+			match("abuse", "192.0.2.7/32", 95),
+			match("firehol", "192.0.2.0/24", 40),
+		},
+		"192.0.3.1": {
+			match("abuse", "192.0.0.0/16", 10),
+		},
+		"2001:db8:1::5": {
+			match("v6", "2001:db8:1::/48", 35),
+		},
+		"2001:db8:2::5": {
+			match("v6", "2001:db8::/32", 30),
+		},
+		"10.0.0.1":    nil,
+		"2001:db9::1": nil,
+	}
+	for addr, want := range tests {
+		if got := table.Lookup(netip.MustParseAddr(addr)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", addr, got, want)
+		}
+	}
+
+	if n := table.Len(); n != 7 {
+		t.Errorf("Len() = %d, want 7", n)
+	}
+	if got := (*Table)(nil).Lookup(netip.MustParseAddr("192.0.2.1")); got != nil {
+		t.Errorf("nil table: got %+v", got)
+	}
+	if got := table.Lookup(netip.Addr{}); got != nil {
+		t.Errorf("invalid address: got %+v", got)
+	}
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields([]Match{
+		match("firehol", "192.0.2.0/24", 40),
+		match("abuse", "192.0.2.7/32", 95),
+		match("spamhaus", "192.0.2.0/23", 60),
+	})
+	if len(fields) != 2 || fields[0].Value != "firehol,abuse,spamhaus" || fields[1].Value != "95" {
+		t.Fatalf("fields %+v", fields)
+	}
+	if fields := Fields(nil); fields != nil {
+		t.Fatalf("no matches: fields %+v", fields)
+	}
+}
@@ -0,0 +1,79 @@
+package window
+
+import (
+	"sync"
+	"time"
+)
+
+type Counter struct {
+	mu     sync.Mutex
+	window time.Duration
+	hits   map[string][]time.Time
+	swept  time.Time
+}
+
+func NewCounter(window time.Duration) *Counter {
+	return &Counter{
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+func (c *Counter) Add(key string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.swept) > c.window {
+		c.sweepLocked(now)
+	}
+
+	hits := append(c.prune(key, now), now)
+	c.hits[key] = hits
+	return len(hits)
+}
+
+func (c *Counter) Count(key string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hits := c.prune(key, now)
+	if len(hits) == 0 {
+		delete(c.hits, key)
+	} else {
+		c.hits[key] = hits
+	}
+	return len(hits)
+}
+
+func (c *Counter) Reset(key string) {
+	c.mu.Lock()
+	delete(c.hits, key)
+	c.mu.Unlock()
+}
+
+func (c *Counter) Sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepLocked(now)
+}
+
+func (c *Counter) sweepLocked(now time.Time) {
+	c.swept = now
+	for key := range c.hits {
+		if hits := c.prune(key, now); len(hits) == 0 {
+			delete(c.hits, key)
+		} else {
+			c.hits[key] = hits
+		}
+	}
+}
+
+func (c *Counter) prune(key string, now time.Time) []time.Time {
+	hits := c.hits[key]
+	cutoff := now.Add(-c.window)
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}